@@ -0,0 +1,123 @@
+package insights
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// AuditRecord is one line of the upload audit log: a structured
+// account of what data left the host, when, and where it went.
+// Unlike debug logging it is written regardless of verbosity, as a
+// record for regulated environments.
+type AuditRecord struct {
+	// Time is when the upload attempt finished.
+	Time time.Time `json:"time"`
+	// CollectorID names the collector whose data was uploaded.
+	CollectorID string `json:"collector_id"`
+	// ContentType is the content type the archive was submitted as.
+	ContentType string `json:"content_type"`
+	// ArchiveSize is the archive size in bytes, zero when streamed.
+	ArchiveSize int64 `json:"archive_size,omitempty"`
+	// Checksum is the archive's SHA-256 digest, empty when streamed.
+	Checksum string `json:"checksum,omitempty"`
+	// RequestID is the ID Ingress assigned, empty on failure.
+	RequestID string `json:"request_id,omitempty"`
+	// URL is the destination the archive was sent to.
+	URL string `json:"url"`
+	// Result is "success" or the error the attempt failed with.
+	Result string `json:"result"`
+}
+
+// AuditLogPath returns the file upload audit records are appended
+// to: the AUDIT_LOG environment variable when set, the audit-log
+// configuration value otherwise. An empty path disables audit
+// logging, the built-in default.
+func AuditLogPath() string {
+	if path := os.Getenv("AUDIT_LOG"); path != "" {
+		return path
+	}
+	return currentConfig.AuditLog
+}
+
+// auditUpload appends an audit record for one upload attempt sent to
+// target. A record that cannot be written is logged as a warning but
+// does not fail the run; the upload itself already happened.
+func auditUpload(path string, c Collector, target string, result RunResult, err error) {
+	if path == "" {
+		path = AuditLogPath()
+	}
+	if path == "" {
+		return
+	}
+	record := AuditRecord{
+		Time:        time.Now(),
+		CollectorID: c.Meta.ID,
+		ContentType: c.Upload.ContentType,
+		ArchiveSize: result.ArchiveSize,
+		Checksum:    result.Checksum,
+		RequestID:   result.RequestID,
+		URL:         target,
+		Result:      "success",
+	}
+	if err != nil {
+		record.Result = err.Error()
+	}
+	if writeErr := appendAuditRecord(path, record); writeErr != nil {
+		slog.Warn("could not write audit record", "path", path, "error", writeErr)
+	}
+}
+
+// AuditArchiveUpload appends an audit record for an upload attempt
+// made outside a collector run — a spool flush or a manual archive
+// upload — so the audit log covers every attempt that sends data off
+// the host, not only the ones a Runner performed. Size and checksum
+// are read from the archive itself; collectorID may be empty when it
+// cannot be determined. Like auditUpload, a record that cannot be
+// written only warns.
+func AuditArchiveUpload(collectorID, contentType, target, archive, requestID string, err error) {
+	path := AuditLogPath()
+	if path == "" {
+		return
+	}
+	record := AuditRecord{
+		Time:        time.Now(),
+		CollectorID: collectorID,
+		ContentType: contentType,
+		RequestID:   requestID,
+		URL:         target,
+		Result:      "success",
+	}
+	if info, statErr := os.Stat(archive); statErr == nil {
+		record.ArchiveSize = info.Size()
+	}
+	if sum, sumErr := fileChecksum(archive); sumErr == nil {
+		record.Checksum = sum
+	}
+	if err != nil {
+		record.Result = err.Error()
+	}
+	if writeErr := appendAuditRecord(path, record); writeErr != nil {
+		slog.Warn("could not write audit record", "path", path, "error", writeErr)
+	}
+}
+
+// appendAuditRecord appends the record to the audit log as one JSON
+// line.
+func appendAuditRecord(path string, record AuditRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("could not encode audit record: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("could not open audit log: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("could not append to audit log: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package insights
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAuditUpload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	c := Collector{
+		Meta:   MetaOptions{ID: "example"},
+		Upload: UploadOptions{ContentType: "application/vnd.redhat.test+tgz"},
+	}
+
+	auditUpload(path, c, "https://edge.example.com/upload",
+		RunResult{RequestID: "abc123", ArchiveSize: 42}, nil)
+	auditUpload(path, c, "https://edge.example.com/upload",
+		RunResult{}, fmt.Errorf("%w: connection refused", ErrUpload))
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected two audit records, got %d", len(lines))
+	}
+
+	var record AuditRecord
+	if err := json.Unmarshal([]byte(lines[0]), &record); err != nil {
+		t.Fatal(err)
+	}
+	if record.CollectorID != "example" || record.RequestID != "abc123" || record.Result != "success" {
+		t.Errorf("unexpected success record: %+v", record)
+	}
+	if record.URL != "https://edge.example.com/upload" {
+		t.Errorf("record does not carry the upload destination: %+v", record)
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &record); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(record.Result, "connection refused") {
+		t.Errorf("failure record does not carry the error: %+v", record)
+	}
+}
+
+func TestAuditArchiveUploadFlush(t *testing.T) {
+	t.Setenv("CACHE_DIR", t.TempDir())
+	logPath := filepath.Join(t.TempDir(), "audit.log")
+	t.Setenv("AUDIT_LOG", logPath)
+
+	// A flushed archive carries its collector in the ID-timestamp
+	// name Collect gave the collection.
+	archive := filepath.Join(t.TempDir(), "os-release-1700000000.tar.gz")
+	if err := os.WriteFile(archive, []byte("payload"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := SpoolArchive(archive, "application/vnd.redhat.test+tgz",
+		"https://edge.example.com/upload"); err != nil {
+		t.Fatal(err)
+	}
+	queue, err := SpooledArchives()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(queue) != 1 {
+		t.Fatalf("expected 1 spooled archive, got %d", len(queue))
+	}
+
+	s := queue[0]
+	AuditArchiveUpload(CollectionID(s.Path), s.ContentType, s.URL, s.Path, "abc123", nil)
+
+	data, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var record AuditRecord
+	if err := json.Unmarshal([]byte(strings.TrimSpace(string(data))), &record); err != nil {
+		t.Fatal(err)
+	}
+	if record.CollectorID != "os-release" {
+		t.Errorf("collector not derived from the archive name: %+v", record)
+	}
+	if record.URL != "https://edge.example.com/upload" {
+		t.Errorf("record does not carry the flush destination: %+v", record)
+	}
+	if record.ArchiveSize != int64(len("payload")) || record.Checksum == "" {
+		t.Errorf("record does not describe the archive: %+v", record)
+	}
+	if record.RequestID != "abc123" || record.Result != "success" {
+		t.Errorf("unexpected outcome fields: %+v", record)
+	}
+}
@@ -0,0 +1,110 @@
+package insights
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// The upload circuit breaker protects hosts and Ingress during
+// outages: after breakerThreshold consecutive upload failures,
+// scheduled runs are skipped entirely for breakerCooldown, instead of
+// wasting a full collection cycle per timer firing. Manual runs are
+// never affected, so an operator can always probe whether Ingress is
+// back.
+const (
+	breakerThreshold = 3
+	breakerCooldown  = 30 * time.Minute
+)
+
+// breakerState is the persisted upload failure record. It is shared
+// across collectors, because all of them upload to the same Ingress.
+type breakerState struct {
+	// ConsecutiveFailures counts upload failures since the last
+	// success.
+	ConsecutiveFailures int `json:"consecutive_failures"`
+	// LastFailure is when the most recent failure happened.
+	LastFailure time.Time `json:"last_failure"`
+}
+
+// breakerPath returns the path of the persisted breaker state.
+func breakerPath() string {
+	return filepath.Join(CacheDir(), "upload-breaker.json")
+}
+
+// getBreaker reads the persisted breaker state. A missing or
+// unreadable record reads as a closed breaker: the breaker is an
+// optimization and must never block uploads by itself.
+func getBreaker() breakerState {
+	data, err := os.ReadFile(breakerPath())
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			slog.Warn("could not read upload breaker state", "error", err)
+		}
+		return breakerState{}
+	}
+	var state breakerState
+	if err := json.Unmarshal(data, &state); err != nil {
+		slog.Warn("could not parse upload breaker state", "error", err)
+		return breakerState{}
+	}
+	return state
+}
+
+// setBreaker persists the breaker state.
+func setBreaker(state breakerState) error {
+	if err := os.MkdirAll(CacheDir(), 0o700); err != nil {
+		return fmt.Errorf("could not create cache directory: %w", err)
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("could not encode breaker state: %w", err)
+	}
+	if err := os.WriteFile(breakerPath(), data, 0o600); err != nil {
+		return fmt.Errorf("could not record breaker state: %w", err)
+	}
+	return nil
+}
+
+// recordUploadResult feeds an upload outcome into the breaker: an
+// ErrUpload failure increments the consecutive-failure count, any
+// success resets it. Other errors leave the state alone, since they
+// say nothing about Ingress health.
+func recordUploadResult(err error) {
+	var state breakerState
+	switch {
+	case err == nil:
+		// Reset; writing the zero state below.
+	case errors.Is(err, ErrUpload):
+		state = getBreaker()
+		state.ConsecutiveFailures++
+		state.LastFailure = time.Now()
+	default:
+		return
+	}
+	if recordErr := setBreaker(state); recordErr != nil {
+		slog.Warn("could not update upload breaker", "error", recordErr)
+	}
+}
+
+// breakerOpen reports whether the breaker is open — enough
+// consecutive upload failures happened recently — and until when.
+// Once the cool-down since the last failure has passed, the breaker
+// half-opens: the next run attempts an upload again and either resets
+// or re-opens it.
+func breakerOpen() (time.Time, bool) {
+	state := getBreaker()
+	if state.ConsecutiveFailures < breakerThreshold {
+		return time.Time{}, false
+	}
+	until := state.LastFailure.Add(breakerCooldown)
+	if time.Now().After(until) {
+		return time.Time{}, false
+	}
+	return until, true
+}
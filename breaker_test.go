@@ -0,0 +1,41 @@
+package insights
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestUploadBreaker(t *testing.T) {
+	t.Setenv("CACHE_DIR", t.TempDir())
+
+	if _, open := breakerOpen(); open {
+		t.Fatal("breaker must start closed")
+	}
+
+	// Failures below the threshold keep the breaker closed.
+	uploadErr := fmt.Errorf("%w: connection refused", ErrUpload)
+	for i := 0; i < breakerThreshold-1; i++ {
+		recordUploadResult(uploadErr)
+	}
+	if _, open := breakerOpen(); open {
+		t.Error("breaker opened below the failure threshold")
+	}
+
+	recordUploadResult(uploadErr)
+	if _, open := breakerOpen(); !open {
+		t.Error("breaker did not open after repeated upload failures")
+	}
+
+	// Non-upload errors say nothing about Ingress health and must not
+	// touch the state.
+	recordUploadResult(fmt.Errorf("%w: something else", ErrCollect))
+	if _, open := breakerOpen(); !open {
+		t.Error("an unrelated error reset the breaker")
+	}
+
+	// A success closes it again.
+	recordUploadResult(nil)
+	if _, open := breakerOpen(); open {
+		t.Error("breaker did not close after a successful upload")
+	}
+}
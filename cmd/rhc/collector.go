@@ -0,0 +1,2169 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+	"time"
+
+	"github.com/urfave/cli/v3"
+
+	insights "github.com/RedHatInsights/rhc-insights"
+)
+
+var collectorCommand = &cli.Command{
+	Name:  "collector",
+	Usage: "Manage data collectors",
+	Commands: []*cli.Command{
+		{
+			Name:  "list",
+			Usage: "List defined collectors",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:  "format",
+					Usage: "output format: human, table, json, csv, or a Go template applied to each collector (e.g. '{{.ID}}'; fields: ID, Feature, Enabled, Command, Path, Timer; '{{json .}}' emits JSON)",
+					Value: "human",
+				},
+				&cli.StringFlag{
+					Name:  "columns",
+					Usage: "comma-separated table columns (id, feature, enabled, command, path, timer)",
+					Value: "id,feature,enabled",
+				},
+				&cli.BoolFlag{
+					Name:  "no-header",
+					Usage: "omit the table header",
+				},
+				&cli.BoolFlag{
+					Name:  "wide",
+					Usage: "include last-run and timer state in JSON output",
+				},
+				featureFlag(),
+				labelFlag(),
+				&cli.BoolFlag{
+					Name:  "enabled",
+					Usage: "only show collectors whose timer is enabled",
+				},
+				&cli.BoolFlag{
+					Name:  "disabled",
+					Usage: "only show collectors whose timer is not enabled",
+				},
+			},
+			Action: runList,
+		},
+		{
+			Name:      "info",
+			Usage:     "Show a collector's definition",
+			ArgsUsage: "COLLECTOR|PATTERN",
+			Flags: []cli.Flag{
+				formatFlag(),
+				&cli.BoolFlag{
+					Name:  "all",
+					Usage: "show every defined collector",
+				},
+				&cli.BoolFlag{
+					Name:  "path-only",
+					Usage: "print only the path of the collector's definition file",
+				},
+				&cli.BoolFlag{
+					Name:  "resolve",
+					Usage: "show the effective command, environment and identity Collect would use",
+				},
+			},
+			Action: runInfo,
+		},
+		{
+			Name:      "edit",
+			Usage:     "Edit a collector's definition and re-validate it",
+			ArgsUsage: "COLLECTOR",
+			Action:    runEdit,
+		},
+		{
+			Name:      "cat",
+			Usage:     "Print a collector's raw definition file",
+			ArgsUsage: "COLLECTOR",
+			Flags:     []cli.Flag{formatFlag()},
+			Action:    runCat,
+		},
+		{
+			Name:      "run",
+			Usage:     "Collect and upload data",
+			ArgsUsage: "[COLLECTOR|PATTERN...] [-- ARG...]",
+			Flags: []cli.Flag{
+				&cli.BoolFlag{
+					Name:  "all",
+					Usage: "run every defined collector",
+				},
+				featureFlag(),
+				labelFlag(),
+				&cli.IntFlag{
+					Name:  "max-size",
+					Usage: "refuse to upload archives larger than this many bytes",
+					Value: insights.DefaultMaxArchiveSize,
+				},
+				&cli.BoolFlag{
+					Name:  "keep",
+					Usage: "keep the collection directory after the run",
+				},
+				&cli.BoolFlag{
+					Name:  "keep-on-failure",
+					Usage: "keep the collection directory when the run fails, for inspection",
+					Value: true,
+				},
+				&cli.BoolFlag{
+					Name:  "keep-uploaded",
+					Usage: "keep the archive even after a successful upload",
+				},
+				&cli.BoolFlag{
+					Name:  "no-upload",
+					Usage: "collect and compress only; keep the archive instead of uploading it",
+				},
+				&cli.BoolFlag{
+					Name:  "upload-only-if-changed",
+					Usage: "skip the upload when the collected data matches the last upload",
+				},
+				&cli.BoolFlag{
+					Name:  "force",
+					Usage: "upload even when the collected data is unchanged",
+				},
+				&cli.StringFlag{
+					Name:  "archive",
+					Usage: "upload this pre-built archive instead of collecting",
+				},
+				&cli.BoolFlag{
+					Name:  "stdin",
+					Usage: "upload an archive read from standard input instead of collecting",
+				},
+				&cli.StringFlag{
+					Name:  "content-type",
+					Usage: "content type for --archive and --stdin uploads",
+				},
+				&cli.DurationFlag{
+					Name:  "upload-timeout",
+					Usage: "abort a stalled upload after this long (0 means no timeout)",
+				},
+				rateLimitFlag(),
+				&cli.DurationFlag{
+					Name:  "deadline",
+					Usage: "bound the whole run, collection included (0 means no deadline)",
+				},
+				&cli.BoolFlag{
+					Name:  "preflight",
+					Usage: "check that Ingress is reachable before collecting anything",
+					Value: true,
+				},
+				&cli.BoolFlag{
+					Name:  "stream",
+					Usage: "stream the archive to Ingress without writing it to disk",
+				},
+				&cli.BoolFlag{
+					Name:  "wait",
+					Usage: "wait for a concurrent run of the same collector instead of failing",
+				},
+				&cli.StringFlag{
+					Name:  "collectors-from",
+					Usage: "read the collectors to run from this file, one ID or pattern per line ('-' for stdin); failures do not stop the batch",
+				},
+				&cli.IntFlag{
+					Name:  "compression-level",
+					Usage: "gzip level for the archive, 1 (fastest) to 9 (smallest); 0 picks the default",
+				},
+				&cli.IntFlag{
+					Name:  "repeat",
+					Usage: "run the collector this many times, aggregating timings (soak mode)",
+				},
+				&cli.DurationFlag{
+					Name:  "interval",
+					Usage: "pause between --repeat runs",
+				},
+				&cli.BoolFlag{
+					Name:  "summary",
+					Usage: "print a summary table after a multi-collector run",
+				},
+				&cli.BoolFlag{
+					Name:  "show-manifest",
+					Usage: "show what the uploaded archive contains, with file sizes and digests",
+				},
+				&cli.BoolFlag{
+					Name:  "print-archive-tree",
+					Usage: "print the collected files as a tree with sizes",
+				},
+				&cli.BoolFlag{
+					Name:  "tmpfs",
+					Usage: "back collection directories with tmpfs so data never touches disk (requires root)",
+				},
+				&cli.StringFlag{
+					Name:  "report",
+					Usage: "write the run results as JSON to `PATH`, regardless of --format",
+				},
+				&cli.BoolFlag{
+					Name:  "reproducible",
+					Usage: "normalize archive metadata so identical data produces identical archives",
+				},
+				&cli.StringFlag{
+					Name:  "audit-log",
+					Usage: "append a JSON record of every upload attempt to this file",
+				},
+				&cli.StringFlag{
+					Name:    "metrics-dir",
+					Usage:   "write per-collector run metrics in Prometheus textfile format into this directory",
+					Sources: cli.EnvVars("METRICS_DIR"),
+				},
+				formatFlag(),
+			},
+			Action: runRun,
+		},
+		{
+			Name:      "upload",
+			Usage:     "Upload a kept collection directory or archive",
+			ArgsUsage: "PATH",
+			Flags: []cli.Flag{
+				formatFlag(),
+				&cli.StringFlag{
+					Name:  "content-type",
+					Usage: "content type the data is submitted as",
+				},
+				&cli.IntFlag{
+					Name:  "compression-level",
+					Usage: "gzip level when compressing a directory, 1 (fastest) to 9 (smallest); 0 picks the default",
+				},
+				&cli.DurationFlag{
+					Name:  "upload-timeout",
+					Usage: "abort a stalled upload after this long (0 means no timeout)",
+				},
+				rateLimitFlag(),
+			},
+			Action: runUpload,
+		},
+		{
+			Name:  "flush",
+			Usage: "Upload archives spooled by failed runs",
+			Flags: []cli.Flag{
+				formatFlag(),
+				&cli.DurationFlag{
+					Name:  "upload-timeout",
+					Usage: "abort a stalled upload after this long (0 means no timeout)",
+				},
+				rateLimitFlag(),
+			},
+			Action: runFlush,
+		},
+		{
+			Name:      "enable",
+			Usage:     "Enable a collector's timer",
+			ArgsUsage: "COLLECTOR",
+			Flags: []cli.Flag{
+				&cli.BoolFlag{
+					Name:  "user",
+					Usage: "manage the timer in the user's systemd session (default: auto-detect from privileges)",
+				},
+				&cli.DurationFlag{
+					Name:  "randomized-delay",
+					Usage: "spread timer activations by up to this much random jitter (default: the configuration file's systemd.randomized-delay)",
+				},
+			},
+			Action: runEnable,
+		},
+		{
+			Name:      "disable",
+			Usage:     "Disable a collector's timer",
+			ArgsUsage: "COLLECTOR",
+			Flags: []cli.Flag{
+				formatFlag(),
+				&cli.BoolFlag{
+					Name:  "user",
+					Usage: "manage the timer in the user's systemd session (default: auto-detect from privileges)",
+				},
+				&cli.BoolFlag{
+					Name:  "now",
+					Usage: "also stop a running timer immediately; with --now=false it keeps running until the next boot",
+					Value: true,
+				},
+			},
+			Action: runDisable,
+		},
+		{
+			Name:      "status",
+			Usage:     "Show a collector's timer and last-run state",
+			ArgsUsage: "COLLECTOR",
+			Flags: []cli.Flag{
+				formatFlag(),
+				&cli.BoolFlag{
+					Name:  "user",
+					Usage: "manage the timer in the user's systemd session (default: auto-detect from privileges)",
+				},
+			},
+			Action: runStatus,
+		},
+		{
+			Name:  "timers",
+			Usage: "Show the state of collector timers",
+			Flags: []cli.Flag{
+				labelFlag(),
+				&cli.StringFlag{
+					Name:  "format",
+					Usage: "output format (human, json, csv)",
+					Value: "human",
+				},
+				&cli.BoolFlag{
+					Name:  "user",
+					Usage: "manage the timer in the user's systemd session (default: auto-detect from privileges)",
+				},
+				&cli.StringFlag{
+					Name:  "since",
+					Usage: "only show collectors that last ran after this time (RFC3339 or a duration ago, e.g. 24h)",
+				},
+				&cli.StringFlag{
+					Name:  "until",
+					Usage: "only show collectors that last ran before this time (RFC3339 or a duration ago, e.g. 1h)",
+				},
+				&cli.BoolFlag{
+					Name:  "failed-only",
+					Usage: "only show collectors whose last run failed",
+				},
+			},
+			Action: runTimers,
+		},
+		{
+			Name:  "gc",
+			Usage: "Remove stale collection directories",
+			Flags: []cli.Flag{
+				formatFlag(),
+				&cli.DurationFlag{
+					Name:  "older-than",
+					Usage: "only remove collections older than this",
+					Value: 24 * time.Hour,
+				},
+				&cli.BoolFlag{
+					Name:  "dry-run",
+					Usage: "list what would be removed without removing anything",
+				},
+			},
+			Action: runGC,
+		},
+		{
+			Name:   "show-config",
+			Usage:  "Show the effective configuration and where each value comes from",
+			Flags:  []cli.Flag{formatFlag()},
+			Action: runShowConfig,
+		},
+		{
+			Name:      "journal",
+			Usage:     "Show a collector's journal entries",
+			ArgsUsage: "COLLECTOR",
+			Action:    runJournal,
+		},
+		{
+			Name:   "doctor",
+			Usage:  "Check the host for common collection and upload problems",
+			Flags:  []cli.Flag{formatFlag()},
+			Action: runDoctor,
+		},
+		{
+			Name:   "content-types",
+			Usage:  "List the recognized upload content types",
+			Flags:  []cli.Flag{formatFlag()},
+			Action: runContentTypes,
+		},
+	},
+}
+
+func runContentTypes(ctx context.Context, cmd *cli.Command) error {
+	types := insights.KnownContentTypes()
+	if cmd.String("format") == "json" {
+		return printJSON(types)
+	}
+	for _, t := range types {
+		fmt.Println(t)
+	}
+	return nil
+}
+
+// formatFlag returns the flag selecting between human and machine
+// readable output.
+func formatFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:  "format",
+		Usage: "output format (human, json)",
+		Value: "human",
+	}
+}
+
+// featureFlag returns the flag restricting an operation to the named
+// features.
+func featureFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:  "feature",
+		Usage: "only consider collectors of these features (comma-separated, case-insensitive)",
+	}
+}
+
+// featureMatch reports whether the collector's feature is included in
+// the comma-separated filter. An empty filter matches everything.
+func featureMatch(filter string, c insights.Collector) bool {
+	if filter == "" {
+		return true
+	}
+	for _, feature := range strings.Split(filter, ",") {
+		if strings.EqualFold(strings.TrimSpace(feature), c.Meta.Feature) {
+			return true
+		}
+	}
+	return false
+}
+
+// rateLimitFlag returns the shared --rate-limit flag for commands
+// that upload.
+func rateLimitFlag() cli.Flag {
+	return &cli.IntFlag{
+		Name:  "rate-limit",
+		Usage: "cap upload bandwidth at this many bytes per second (0 means unlimited)",
+	}
+}
+
+// labelFlag returns the shared --label flag for commands that filter
+// collectors by their meta labels.
+func labelFlag() cli.Flag {
+	return &cli.StringSliceFlag{
+		Name:  "label",
+		Usage: "only consider collectors carrying this key=value label (repeatable; all must match)",
+	}
+}
+
+// labelMatch reports whether the collector carries every key=value
+// label in filters. An empty filter matches everything; a filter
+// without an = is an error.
+func labelMatch(filters []string, c insights.Collector) (bool, error) {
+	for _, filter := range filters {
+		key, value, ok := strings.Cut(filter, "=")
+		if !ok {
+			return false, fmt.Errorf("invalid label filter %q (expected key=value)", filter)
+		}
+		if c.Meta.Labels[key] != value {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// timerStateMatch applies the --enabled/--disabled filters: it
+// reports whether the collector's timer state matches what the flags
+// ask for. Without either flag everything matches and no timer is
+// queried.
+func timerStateMatch(cmd *cli.Command, c insights.Collector) (bool, error) {
+	if !cmd.Bool("enabled") && !cmd.Bool("disabled") {
+		return true, nil
+	}
+	timer, err := insights.GetTimer(c.Meta.ID, userScope(cmd))
+	if err != nil {
+		return false, err
+	}
+	if cmd.Bool("enabled") {
+		return timer.Enabled, nil
+	}
+	return !timer.Enabled, nil
+}
+
+// prettyJSON selects indented JSON output. It is set once flags are
+// parsed: the --pretty flag when given, otherwise whether stdout is
+// a terminal, so pipelines get compact output and humans get
+// readable output.
+var prettyJSON bool
+
+// printJSON writes v to stdout as JSON, indented when prettyJSON is
+// set.
+func printJSON(v any) error {
+	var data []byte
+	var err error
+	if prettyJSON {
+		data, err = json.MarshalIndent(v, "", "  ")
+	} else {
+		data, err = json.Marshal(v)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(data))
+	return nil
+}
+
+// userScope reports whether timer operations should target the
+// user's systemd session. Without an explicit --user flag it follows
+// the caller's privileges: unprivileged users get session timers.
+func userScope(cmd *cli.Command) bool {
+	if cmd.IsSet("user") {
+		return cmd.Bool("user")
+	}
+	return os.Geteuid() != 0
+}
+
+// argumentID returns the collector ID given as the first positional
+// argument.
+func argumentID(cmd *cli.Command) (string, error) {
+	id := cmd.Args().First()
+	if id == "" {
+		return "", fmt.Errorf("no collector specified")
+	}
+	return id, nil
+}
+
+// CollectorInfoDTO is the flat, output-friendly view of a collector
+// used by the list command.
+type CollectorInfoDTO struct {
+	ID      string            `json:"id"`
+	Feature string            `json:"feature"`
+	Labels  map[string]string `json:"labels,omitempty"`
+	Enabled bool              `json:"enabled"`
+	Command []string          `json:"command"`
+	Path    string            `json:"path"`
+	Timer   string            `json:"timer"`
+}
+
+// newCollectorInfoDTO flattens a collector for output.
+func newCollectorInfoDTO(c insights.Collector) CollectorInfoDTO {
+	return CollectorInfoDTO{
+		ID:      c.Meta.ID,
+		Feature: c.Meta.Feature,
+		Labels:  c.Meta.Labels,
+		Enabled: c.Meta.Enabled,
+		Command: c.Exec.Command,
+		Path:    c.Generated.Path,
+		Timer:   insights.TimerUnit(c.Meta.ID),
+	}
+}
+
+// CollectorWideDTO extends CollectorInfoDTO with last-run and timer
+// state, so one list call can drive a dashboard without per-collector
+// status queries.
+type CollectorWideDTO struct {
+	CollectorInfoDTO
+	// LastRun is the Unix timestamp of the last run, zero when the
+	// collector never ran.
+	LastRun      int64 `json:"last_run"`
+	TimerEnabled bool  `json:"timer_enabled"`
+	TimerActive  bool  `json:"timer_active"`
+}
+
+// newCollectorWideDTO flattens a collector including its runtime
+// state.
+func newCollectorWideDTO(c insights.Collector, user bool) (CollectorWideDTO, error) {
+	dto := CollectorWideDTO{CollectorInfoDTO: newCollectorInfoDTO(c)}
+	last, err := insights.GetLastRun(c.Meta.ID)
+	if err != nil {
+		return dto, err
+	}
+	if !last.Time.IsZero() {
+		dto.LastRun = last.Time.Unix()
+	}
+	timer, err := insights.GetTimer(c.Meta.ID, user)
+	if err != nil {
+		return dto, err
+	}
+	dto.TimerEnabled = timer.Enabled
+	dto.TimerActive = timer.Active
+	return dto, nil
+}
+
+// printTemplate renders each DTO through a Go template, one line per
+// entry. A json helper is available for structured fields.
+func printTemplate[T any](format string, dtos []T) error {
+	tmpl, err := template.New("format").Funcs(template.FuncMap{
+		"json": func(v any) (string, error) {
+			data, err := json.Marshal(v)
+			return string(data), err
+		},
+	}).Parse(format)
+	if err != nil {
+		return fmt.Errorf("invalid template: %w", err)
+	}
+	for _, dto := range dtos {
+		if err := tmpl.Execute(os.Stdout, dto); err != nil {
+			return fmt.Errorf("could not render template: %w", err)
+		}
+		fmt.Println()
+	}
+	return nil
+}
+
+// columnValue renders one column of a CollectorInfoDTO.
+func columnValue(dto CollectorInfoDTO, column string) (string, error) {
+	switch column {
+	case "id":
+		return dto.ID, nil
+	case "feature":
+		return dto.Feature, nil
+	case "enabled":
+		return strconv.FormatBool(dto.Enabled), nil
+	case "command":
+		return strings.Join(dto.Command, " "), nil
+	case "path":
+		return dto.Path, nil
+	case "timer":
+		return dto.Timer, nil
+	}
+	return "", fmt.Errorf("unknown column %q (valid: id, feature, enabled, command, path, timer)", column)
+}
+
+func runList(ctx context.Context, cmd *cli.Command) error {
+	if cmd.Bool("enabled") && cmd.Bool("disabled") {
+		return fmt.Errorf("--enabled and --disabled are mutually exclusive")
+	}
+	collectors, err := insights.GetCollectors()
+	if err != nil {
+		return err
+	}
+
+	// Filter once; both the plain and the wide output are built from
+	// the same surviving set, so the timer-state filters query
+	// systemctl only once per collector.
+	filtered := make([]insights.Collector, 0, len(collectors))
+	for _, c := range collectors {
+		if !featureMatch(cmd.String("feature"), c) {
+			continue
+		}
+		if match, err := labelMatch(cmd.StringSlice("label"), c); err != nil {
+			return err
+		} else if !match {
+			continue
+		}
+		if match, err := timerStateMatch(cmd, c); err != nil {
+			return err
+		} else if !match {
+			continue
+		}
+		filtered = append(filtered, c)
+	}
+
+	if cmd.Bool("wide") {
+		if cmd.String("format") != "json" {
+			return fmt.Errorf("--wide requires --format json")
+		}
+		wide := make([]CollectorWideDTO, 0, len(filtered))
+		for _, c := range filtered {
+			dto, err := newCollectorWideDTO(c, userScope(cmd))
+			if err != nil {
+				return err
+			}
+			wide = append(wide, dto)
+		}
+		return printJSON(wide)
+	}
+
+	dtos := make([]CollectorInfoDTO, 0, len(filtered))
+	for _, c := range filtered {
+		dtos = append(dtos, newCollectorInfoDTO(c))
+	}
+
+	switch format := cmd.String("format"); {
+	case format == "json":
+		return printJSON(dtos)
+	case strings.Contains(format, "{{"):
+		return printTemplate(format, dtos)
+	case format == "human" || format == "table" || format == "csv":
+	default:
+		return fmt.Errorf("unknown format %q", format)
+	}
+
+	columns := strings.Split(cmd.String("columns"), ",")
+	for i := range columns {
+		columns[i] = strings.TrimSpace(columns[i])
+	}
+
+	if cmd.String("format") == "csv" {
+		rows := make([][]string, 0, len(dtos))
+		for _, dto := range dtos {
+			values := make([]string, len(columns))
+			for i, column := range columns {
+				value, err := columnValue(dto, column)
+				if err != nil {
+					return err
+				}
+				values[i] = value
+			}
+			rows = append(rows, values)
+		}
+		return writeCSV(columns, rows, cmd.Bool("no-header"))
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	if !cmd.Bool("no-header") {
+		headers := make([]string, len(columns))
+		for i, column := range columns {
+			headers[i] = strings.ToUpper(column)
+		}
+		fmt.Fprintln(w, strings.Join(headers, "\t"))
+	}
+	for _, dto := range dtos {
+		values := make([]string, len(columns))
+		for i, column := range columns {
+			value, err := columnValue(dto, column)
+			if err != nil {
+				return err
+			}
+			values[i] = value
+		}
+		fmt.Fprintln(w, strings.Join(values, "\t"))
+	}
+	return w.Flush()
+}
+
+func runInfo(ctx context.Context, cmd *cli.Command) error {
+	if cmd.Bool("all") {
+		collectors, err := insights.GetCollectors()
+		if err != nil {
+			return err
+		}
+		if cmd.Bool("path-only") {
+			printPaths(collectors)
+			return nil
+		}
+		if cmd.Bool("resolve") {
+			return printResolved(collectors, cmd.String("format") == "json")
+		}
+		if cmd.String("format") == "json" {
+			dtos := make([]CollectorInfoDTO, 0, len(collectors))
+			for _, c := range collectors {
+				dtos = append(dtos, newCollectorInfoDTO(c))
+			}
+			return printJSON(dtos)
+		}
+		for i, c := range collectors {
+			if i > 0 {
+				fmt.Println()
+			}
+			printInfoHuman(c, userScope(cmd))
+		}
+		return nil
+	}
+
+	id, err := argumentID(cmd)
+	if err != nil {
+		return err
+	}
+	collectors, err := resolveCollectors([]string{id})
+	if err != nil {
+		return err
+	}
+
+	if cmd.Bool("path-only") {
+		printPaths(collectors)
+		return nil
+	}
+	if cmd.Bool("resolve") {
+		return printResolved(collectors, cmd.String("format") == "json")
+	}
+	if cmd.String("format") == "json" {
+		// A plain ID keeps the single-object output scripts rely on.
+		if len(collectors) == 1 {
+			return printJSON(collectors[0])
+		}
+		return printJSON(collectors)
+	}
+	for i, c := range collectors {
+		if i > 0 {
+			fmt.Println()
+		}
+		printInfoHuman(c, userScope(cmd))
+	}
+	return nil
+}
+
+// printResolved shows what Collect would actually run for each
+// collector, in the raw-TOML-versus-effective sense: extends,
+// [exec.env] expansion and resource-limit wrapping applied.
+func printResolved(collectors []insights.Collector, asJSON bool) error {
+	if asJSON {
+		type resolvedRow struct {
+			ID string `json:"id"`
+			insights.ResolvedExec
+		}
+		rows := make([]resolvedRow, 0, len(collectors))
+		for _, c := range collectors {
+			rows = append(rows, resolvedRow{ID: c.Meta.ID, ResolvedExec: insights.ResolveExec(c)})
+		}
+		if len(rows) == 1 {
+			return printJSON(rows[0])
+		}
+		return printJSON(rows)
+	}
+	for i, c := range collectors {
+		if i > 0 {
+			fmt.Println()
+		}
+		resolved := insights.ResolveExec(c)
+		fmt.Printf("ID:           %s\n", c.Meta.ID)
+		for _, argv := range resolved.Commands {
+			fmt.Printf("Runs:         %v\n", argv)
+		}
+		workDir := resolved.WorkingDir
+		if workDir == "" {
+			workDir = "$COLLECTION_DIRECTORY"
+		}
+		fmt.Printf("Working dir:  %s\n", workDir)
+		for _, entry := range resolved.Env {
+			fmt.Printf("Env:          %s\n", entry)
+		}
+		if resolved.ClearEnv {
+			fmt.Printf("Environment:  cleared, only the entries above\n")
+		}
+		fmt.Printf("UID/GID:      %s/%s\n", resolved.UID, resolved.GID)
+		if resolved.NoNetwork {
+			fmt.Printf("Network:      unshared (no network)\n")
+		}
+	}
+	return nil
+}
+
+// printPaths prints the definition file paths, one per line, so the
+// output can be fed straight to an editor or xargs.
+func printPaths(collectors []insights.Collector) {
+	for _, c := range collectors {
+		fmt.Println(c.Generated.Path)
+	}
+}
+
+// resolveCollectors expands the positional collector arguments into
+// collectors, resolving glob patterns such as 'advisor-*' against
+// the loaded collector IDs. Duplicates are dropped, order is kept.
+func resolveCollectors(ids []string) ([]insights.Collector, error) {
+	var collectors []insights.Collector
+	seen := make(map[string]bool)
+	add := func(c insights.Collector) {
+		if !seen[c.Meta.ID] {
+			seen[c.Meta.ID] = true
+			collectors = append(collectors, c)
+		}
+	}
+	for _, id := range ids {
+		if strings.ContainsAny(id, "*?[") {
+			matched, err := insights.MatchCollectors(id)
+			if err != nil {
+				return nil, err
+			}
+			for _, c := range matched {
+				add(c)
+			}
+			continue
+		}
+		c, err := insights.GetCollector(id)
+		if err != nil {
+			return nil, err
+		}
+		add(c)
+	}
+	return collectors, nil
+}
+
+// printInfoHuman prints one collector's definition as a block of
+// human-readable fields, flagging a timer unit systemd does not know.
+func printInfoHuman(c insights.Collector, user bool) {
+	fmt.Printf("ID:           %s\n", c.Meta.ID)
+	fmt.Printf("Feature:      %s\n", c.Meta.Feature)
+	if len(c.Meta.Labels) > 0 {
+		pairs := make([]string, 0, len(c.Meta.Labels))
+		for key, value := range c.Meta.Labels {
+			pairs = append(pairs, key+"="+value)
+		}
+		sort.Strings(pairs)
+		fmt.Printf("Labels:       %s\n", strings.Join(pairs, " "))
+	}
+	if len(c.Exec.Steps) > 0 {
+		fmt.Printf("Steps:        %v\n", c.Exec.Steps)
+	} else {
+		fmt.Printf("Command:      %v\n", c.Exec.Command)
+	}
+	fmt.Printf("UID/GID:      %s/%s\n", c.Exec.UID, c.Exec.GID)
+	fmt.Printf("Content type: %s\n", c.Upload.ContentType)
+	timer := insights.TimerUnit(c.Meta.ID)
+	state, err := insights.GetTimer(c.Meta.ID, user)
+	if err == nil && !state.Loaded {
+		fmt.Printf("Timer:        %s (not installed)\n", timer)
+	} else {
+		fmt.Printf("Timer:        %s\n", timer)
+	}
+	if err == nil && state.RandomizedDelay > 0 {
+		fmt.Printf("Jitter:       up to %s\n", state.RandomizedDelay)
+	}
+}
+
+func runEdit(ctx context.Context, cmd *cli.Command) error {
+	id, err := argumentID(cmd)
+	if err != nil {
+		return err
+	}
+	c, err := insights.GetCollector(id)
+	if err != nil {
+		return err
+	}
+
+	// Vendor defaults live in a directory the package manager owns;
+	// edit an override copy in the admin directory instead, which
+	// takes precedence on the search path.
+	path := c.Generated.Path
+	if adminDir := insights.ConfigDir(); filepath.Dir(path) != adminDir {
+		override := filepath.Join(adminDir, filepath.Base(path))
+		if _, err := os.Stat(override); errors.Is(err, fs.ErrNotExist) {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return fmt.Errorf("could not read %s: %w", path, err)
+			}
+			if err := os.MkdirAll(adminDir, 0o755); err != nil {
+				return fmt.Errorf("could not create %s: %w", adminDir, err)
+			}
+			if err := os.WriteFile(override, data, 0o644); err != nil {
+				return fmt.Errorf("could not create override copy: %w", err)
+			}
+		}
+		fmt.Printf("editing override copy %s\n", override)
+		path = override
+	}
+
+	editor := os.Getenv("EDITOR")
+	if editor == "" {
+		editor = os.Getenv("VISUAL")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+	edit := exec.Command(editor, path)
+	edit.Stdin = os.Stdin
+	edit.Stdout = os.Stdout
+	edit.Stderr = os.Stderr
+	if err := edit.Run(); err != nil {
+		return fmt.Errorf("editor failed: %w", err)
+	}
+
+	if err := insights.ValidateCollector(path); err != nil {
+		return fmt.Errorf("%s is invalid after editing, fix it with 'rhc collector edit %s': %w",
+			path, id, err)
+	}
+	return nil
+}
+
+func runCat(ctx context.Context, cmd *cli.Command) error {
+	id, err := argumentID(cmd)
+	if err != nil {
+		return err
+	}
+	c, err := insights.GetCollector(id)
+	if err != nil {
+		return err
+	}
+
+	if cmd.String("format") == "json" {
+		return printJSON(c)
+	}
+
+	data, err := os.ReadFile(c.Generated.Path)
+	if err != nil {
+		return fmt.Errorf("could not read %s: %w", c.Generated.Path, err)
+	}
+	_, err = os.Stdout.Write(data)
+	return err
+}
+
+func runRun(ctx context.Context, cmd *cli.Command) error {
+	insights.UploadRateLimit = cmd.Int("rate-limit")
+	insights.CollectInTmpfs = cmd.Bool("tmpfs")
+	if cmd.String("archive") != "" || cmd.Bool("stdin") {
+		return runArchiveUpload(ctx, cmd)
+	}
+
+	// Everything after "--" is passed through to the collector's
+	// command rather than naming further collectors.
+	ids := cmd.Args().Slice()
+	var extraArgs []string
+	for i, arg := range ids {
+		if arg == "--" {
+			extraArgs = ids[i+1:]
+			ids = ids[:i]
+			break
+		}
+	}
+
+	fromList := cmd.String("collectors-from") != ""
+	if fromList {
+		if cmd.Bool("all") || len(ids) > 0 {
+			return fmt.Errorf("--collectors-from cannot be combined with --all or named collectors")
+		}
+		var err error
+		ids, err = readCollectorList(cmd.String("collectors-from"))
+		if err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			return fmt.Errorf("the collector list is empty")
+		}
+	}
+
+	var collectors []insights.Collector
+	if cmd.Bool("all") {
+		var err error
+		collectors, err = insights.GetCollectors()
+		if err != nil {
+			return err
+		}
+	} else {
+		if len(ids) == 0 {
+			return fmt.Errorf("no collector specified")
+		}
+		var err error
+		collectors, err = resolveCollectors(ids)
+		if err != nil {
+			return err
+		}
+	}
+	if len(extraArgs) > 0 && (cmd.Bool("all") || len(collectors) != 1) {
+		return fmt.Errorf("extra arguments require exactly one collector")
+	}
+
+	runner := insights.Runner{Options: runOptionsFromFlags(cmd)}
+	runner.Options.ExtraArgs = extraArgs
+	if deadline := cmd.Duration("deadline"); deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, deadline)
+		defer cancel()
+	}
+	if repeat := int(cmd.Int("repeat")); repeat > 1 {
+		if cmd.Bool("all") || len(collectors) != 1 {
+			return fmt.Errorf("--repeat requires exactly one collector")
+		}
+		return runSoak(ctx, cmd, runner, collectors[0], repeat)
+	}
+	// Collection is the expensive part; when Ingress is unreachable
+	// anyway, better to find out before running any collector. A run
+	// that does not upload has nothing to check.
+	if cmd.Bool("preflight") && !cmd.Bool("no-upload") {
+		if err := insights.Preflight(ctx); err != nil {
+			return err
+		}
+	}
+	var results []CollectorRunDTO
+	var summary []runRow
+	var failed int
+	for _, c := range collectors {
+		if err := ctx.Err(); err != nil {
+			slog.Warn("run interrupted", "remaining", len(collectors)-len(results))
+			return fmt.Errorf("interrupted: %w", err)
+		}
+		if cmd.Bool("all") {
+			if !featureMatch(cmd.String("feature"), c) {
+				continue
+			}
+			if match, err := labelMatch(cmd.StringSlice("label"), c); err != nil {
+				return err
+			} else if !match {
+				continue
+			}
+		}
+		if !c.Meta.Enabled {
+			if cmd.Bool("all") {
+				slog.Debug("skipping disabled collector", "id", c.Meta.ID)
+				continue
+			}
+			// An explicitly named collector runs even when disabled.
+			slog.Warn("collector is disabled, running anyway", "id", c.Meta.ID)
+		}
+		result, err := runner.Run(ctx, c)
+		if err != nil {
+			// A batch read from a list keeps going so one broken
+			// collector cannot block the rest; the summary error
+			// below still fails the invocation.
+			if !fromList {
+				results = append(results, CollectorRunDTO{
+					ID:      c.Meta.ID,
+					Command: result.Command,
+					Error:   err.Error(),
+				})
+				// The report is written even for a failed run, so
+				// automation reading it sees the failure recorded.
+				if path := cmd.String("report"); path != "" {
+					if reportErr := writeReport(path, results); reportErr != nil {
+						slog.Warn("could not write run report", "path", path, "error", reportErr)
+					}
+				}
+				return err
+			}
+			failed++
+			slog.Warn("collector run failed", "id", c.Meta.ID, "error", err)
+			results = append(results, CollectorRunDTO{
+				ID:      c.Meta.ID,
+				Command: result.Command,
+				Error:   err.Error(),
+			})
+			summary = append(summary, newRunRow(c.Meta.ID, result, err))
+			if cmd.String("format") != "json" && !cmd.Bool("quiet") {
+				fmt.Printf("%s: failed: %v\n", c.Meta.ID, err)
+			}
+			continue
+		}
+		dto := CollectorRunDTO{
+			ID:        c.Meta.ID,
+			Command:   result.Command,
+			Success:   true,
+			RequestID: result.RequestID,
+			Archive:   result.Archive,
+			Checksum:  result.Checksum,
+			Manifest:  result.Manifest,
+			Unchanged: result.Unchanged,
+			Skipped:   result.Skipped,
+
+			CollectDurationSeconds: result.CollectDuration.Seconds(),
+			UploadDurationSeconds:  result.UploadDuration.Seconds(),
+
+			UploadAttempts:            result.UploadAttempts,
+			LastUploadDurationSeconds: result.LastUploadDuration.Seconds(),
+			InvocationID:              os.Getenv("INVOCATION_ID"),
+		}
+		if cmd.Bool("show-manifest") {
+			dto.ManifestDetail = result.ManifestEntries
+		}
+		if cmd.Bool("print-archive-tree") {
+			dto.ArchiveTree = buildTree(result.ManifestEntries)
+		}
+		results = append(results, dto)
+		summary = append(summary, newRunRow(c.Meta.ID, result, nil))
+		if cmd.String("format") != "json" && !cmd.Bool("quiet") {
+			printRunHuman(c.Meta.ID, result, runner.Options)
+			if cmd.Bool("show-manifest") {
+				printManifest(result.ManifestEntries)
+			}
+			if cmd.Bool("print-archive-tree") {
+				printTree(dto.ArchiveTree, "")
+			}
+		}
+	}
+
+	if path := cmd.String("report"); path != "" {
+		if err := writeReport(path, results); err != nil {
+			return err
+		}
+	}
+	if cmd.String("format") == "json" {
+		if err := printJSON(results); err != nil {
+			return err
+		}
+	} else if cmd.Bool("summary") {
+		printRunSummary(summary)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d collectors failed", failed, len(collectors))
+	}
+	return nil
+}
+
+// writeReport writes the aggregate run results to path as JSON. The
+// report is staged in the destination directory and renamed into
+// place, so whatever watches the file never reads a partial write.
+func writeReport(path string, results []CollectorRunDTO) error {
+	data, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not encode run report: %w", err)
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return fmt.Errorf("could not write run report: %w", err)
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return fmt.Errorf("could not write run report: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("could not write run report: %w", err)
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return fmt.Errorf("could not write run report: %w", err)
+	}
+	return nil
+}
+
+// runRow is one line of the summary table printed after a
+// multi-collector run.
+type runRow struct {
+	id        string
+	status    string
+	collect   time.Duration
+	upload    time.Duration
+	size      int64
+	requestID string
+}
+
+// newRunRow condenses one run's outcome for the summary table.
+func newRunRow(id string, result insights.RunResult, err error) runRow {
+	row := runRow{
+		id:        id,
+		status:    "ok",
+		collect:   result.CollectDuration,
+		upload:    result.UploadDuration,
+		size:      result.ArchiveSize,
+		requestID: result.RequestID,
+	}
+	switch {
+	case err != nil:
+		row.status = "failed"
+	case result.Skipped:
+		row.status = "skipped"
+	case result.Unchanged:
+		row.status = "unchanged"
+	}
+	return row
+}
+
+// printRunSummary renders the per-collector outcomes as a table with
+// a trailing success/failure count, so a long run --all can be read
+// at a glance.
+func printRunSummary(rows []runRow) {
+	fmt.Println()
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tSTATUS\tCOLLECT\tUPLOAD\tSIZE\tREQUEST")
+	var succeeded, failed int
+	for _, row := range rows {
+		if row.status == "failed" {
+			failed++
+		} else {
+			succeeded++
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\n",
+			row.id, row.status,
+			roundDuration(row.collect), roundDuration(row.upload),
+			row.size, row.requestID)
+	}
+	w.Flush()
+	fmt.Printf("%d succeeded, %d failed\n", succeeded, failed)
+}
+
+// DurationStatsDTO aggregates one timing across a soak run's
+// iterations, in seconds.
+type DurationStatsDTO struct {
+	Min float64 `json:"min"`
+	Max float64 `json:"max"`
+	Avg float64 `json:"avg"`
+}
+
+// RunSummaryDTO is the aggregate outcome of a --repeat soak run.
+type RunSummaryDTO struct {
+	ID string `json:"id"`
+	// Runs counts the iterations actually performed; fewer than
+	// requested when the run was interrupted.
+	Runs     int              `json:"runs"`
+	Failures int              `json:"failures"`
+	Collect  DurationStatsDTO `json:"collect-seconds"`
+	Upload   DurationStatsDTO `json:"upload-seconds"`
+}
+
+// durationStats folds a list of durations into min/max/avg seconds.
+func durationStats(values []time.Duration) DurationStatsDTO {
+	var stats DurationStatsDTO
+	if len(values) == 0 {
+		return stats
+	}
+	var total time.Duration
+	stats.Min = values[0].Seconds()
+	stats.Max = stats.Min
+	for _, value := range values {
+		total += value
+		seconds := value.Seconds()
+		if seconds < stats.Min {
+			stats.Min = seconds
+		}
+		if seconds > stats.Max {
+			stats.Max = seconds
+		}
+	}
+	stats.Avg = (total / time.Duration(len(values))).Seconds()
+	return stats
+}
+
+// runSoak runs one collector --repeat times with --interval pauses,
+// for benchmarking collector scripts and validating Ingress
+// throughput. An interrupt stops the loop early but the partial
+// summary is still printed.
+func runSoak(ctx context.Context, cmd *cli.Command, runner insights.Runner, c insights.Collector, repeat int) error {
+	summary := RunSummaryDTO{ID: c.Meta.ID}
+	var collects, uploads []time.Duration
+	for i := 0; i < repeat; i++ {
+		if i > 0 {
+			if interval := cmd.Duration("interval"); interval > 0 {
+				select {
+				case <-time.After(interval):
+				case <-ctx.Done():
+				}
+			}
+		}
+		if ctx.Err() != nil {
+			slog.Warn("soak run interrupted", "completed", summary.Runs, "requested", repeat)
+			break
+		}
+		result, err := runner.Run(ctx, c)
+		summary.Runs++
+		if err != nil {
+			summary.Failures++
+			slog.Warn("soak iteration failed", "id", c.Meta.ID, "iteration", i+1, "error", err)
+			continue
+		}
+		collects = append(collects, result.CollectDuration)
+		if result.UploadDuration > 0 {
+			uploads = append(uploads, result.UploadDuration)
+		}
+		if cmd.String("format") != "json" && !cmd.Bool("quiet") {
+			printRunHuman(c.Meta.ID, result, runner.Options)
+		}
+	}
+	summary.Collect = durationStats(collects)
+	summary.Upload = durationStats(uploads)
+
+	if cmd.String("format") == "json" {
+		if err := printJSON(summary); err != nil {
+			return err
+		}
+	} else {
+		fmt.Printf("%s: %d runs, %d failed\n", summary.ID, summary.Runs, summary.Failures)
+		fmt.Printf("  collect: min %.3fs avg %.3fs max %.3fs\n",
+			summary.Collect.Min, summary.Collect.Avg, summary.Collect.Max)
+		if len(uploads) > 0 {
+			fmt.Printf("  upload:  min %.3fs avg %.3fs max %.3fs\n",
+				summary.Upload.Min, summary.Upload.Avg, summary.Upload.Max)
+		}
+	}
+	if summary.Failures > 0 {
+		return fmt.Errorf("%d of %d runs failed", summary.Failures, summary.Runs)
+	}
+	return nil
+}
+
+// TreeNodeDTO is one node of the collected-files tree: a directory
+// when it has children, a file with its size otherwise.
+type TreeNodeDTO struct {
+	Name     string         `json:"name"`
+	Size     int64          `json:"size,omitempty"`
+	Children []*TreeNodeDTO `json:"children,omitempty"`
+}
+
+// buildTree folds the flat archive manifest into a directory tree,
+// so collector authors can inspect what was collected without
+// digging through the collections directory by hand.
+func buildTree(entries []insights.ManifestEntry) []*TreeNodeDTO {
+	var roots []*TreeNodeDTO
+	index := make(map[string]*TreeNodeDTO)
+	for _, entry := range entries {
+		parts := strings.Split(entry.Path, string(filepath.Separator))
+		var parent *TreeNodeDTO
+		for i := range parts {
+			prefix := strings.Join(parts[:i+1], string(filepath.Separator))
+			node, ok := index[prefix]
+			if !ok {
+				node = &TreeNodeDTO{Name: parts[i]}
+				index[prefix] = node
+				if parent == nil {
+					roots = append(roots, node)
+				} else {
+					parent.Children = append(parent.Children, node)
+				}
+			}
+			parent = node
+		}
+		parent.Size = entry.Size
+	}
+	return roots
+}
+
+// printTree renders the collected-files tree with indentation and
+// file sizes.
+func printTree(nodes []*TreeNodeDTO, indent string) {
+	for _, node := range nodes {
+		if len(node.Children) > 0 {
+			fmt.Printf("%s%s/\n", indent, node.Name)
+			printTree(node.Children, indent+"  ")
+			continue
+		}
+		fmt.Printf("%s%s (%d bytes)\n", indent, node.Name, node.Size)
+	}
+}
+
+// printManifest renders the archive manifest as a table.
+func printManifest(entries []insights.ManifestEntry) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "PATH\tSIZE\tSHA256")
+	for _, entry := range entries {
+		fmt.Fprintf(w, "%s\t%d\t%s\n", entry.Path, entry.Size, entry.SHA256)
+	}
+	w.Flush()
+}
+
+// readCollectorList reads collector IDs or patterns, one per line,
+// from the file at path, or from standard input when path is "-".
+// Blank lines and lines starting with # are skipped.
+func readCollectorList(path string) ([]string, error) {
+	r := os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("could not read collector list: %w", err)
+		}
+		defer f.Close()
+		r = f
+	}
+	var ids []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		ids = append(ids, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read collector list: %w", err)
+	}
+	return ids, nil
+}
+
+// runArchiveUpload uploads a pre-built archive, given as a file or on
+// standard input, without collecting or compressing anything. It lets
+// an archive produced out-of-band (or on another, air-gapped host) be
+// submitted through the same Upload path.
+func runArchiveUpload(ctx context.Context, cmd *cli.Command) error {
+	if cmd.Bool("all") || cmd.Args().Len() > 0 {
+		return fmt.Errorf("--archive and --stdin cannot be combined with collectors")
+	}
+	contentType := cmd.String("content-type")
+	if contentType == "" {
+		return fmt.Errorf("no content type specified (use --content-type)")
+	}
+
+	archive := cmd.String("archive")
+	fromStdin := cmd.Bool("stdin")
+	if fromStdin {
+		if archive != "" {
+			return fmt.Errorf("--archive and --stdin are mutually exclusive")
+		}
+		f, err := os.CreateTemp("", "rhc-archive-*.tar.gz")
+		if err != nil {
+			return fmt.Errorf("could not buffer standard input: %w", err)
+		}
+		if _, err := io.Copy(f, os.Stdin); err != nil {
+			f.Close()
+			removeAll(f.Name())
+			return fmt.Errorf("could not read standard input: %w", err)
+		}
+		if err := f.Close(); err != nil {
+			removeAll(f.Name())
+			return fmt.Errorf("could not buffer standard input: %w", err)
+		}
+		archive = f.Name()
+		defer removeAll(archive)
+	}
+
+	if deadline := cmd.Duration("deadline"); deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, deadline)
+		defer cancel()
+	}
+
+	requestID, err := insights.Upload(ctx, archive, contentType, cmd.Duration("upload-timeout"))
+	insights.AuditArchiveUpload(insights.CollectionID(archive), contentType,
+		insights.IngressURL(), archive, requestID, err)
+	if err != nil {
+		if fromStdin && errors.Is(err, insights.ErrUpload) {
+			// A file given with --archive stays on disk, but stdin data
+			// would be lost; queue it for a later flush.
+			if spooled, spoolErr := insights.SpoolArchive(archive, contentType, ""); spoolErr == nil {
+				slog.Warn("upload failed, archive spooled for a later flush", "archive", spooled)
+			}
+		}
+		return err
+	}
+
+	if cmd.String("format") == "json" {
+		return printJSON([]CollectorRunDTO{{Success: true, RequestID: requestID, Archive: archive}})
+	}
+	if requestID != "" {
+		fmt.Printf("%s: uploaded (request %s)\n", archive, requestID)
+	} else {
+		fmt.Printf("%s: uploaded\n", archive)
+	}
+	return nil
+}
+
+// runUpload retries just the upload of a kept run: a collection
+// directory (as left by --keep or --keep-on-failure) is compressed
+// first, an archive file is uploaded as is. No collection happens,
+// so an expensive collector does not have to run again just because
+// its upload failed.
+func runUpload(ctx context.Context, cmd *cli.Command) error {
+	path := cmd.Args().First()
+	if path == "" {
+		return fmt.Errorf("no path specified")
+	}
+	contentType := cmd.String("content-type")
+	if contentType == "" {
+		return fmt.Errorf("no content type specified (use --content-type)")
+	}
+
+	insights.UploadRateLimit = cmd.Int("rate-limit")
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("could not read %s: %w", path, err)
+	}
+	archive := path
+	if info.IsDir() {
+		archive, _, err = insights.Compress(ctx, path, int(cmd.Int("compression-level")), false)
+		if err != nil {
+			return err
+		}
+		// The directory is the kept artifact; the archive next to it
+		// is only a vehicle for this upload.
+		defer removeAll(archive)
+	}
+
+	requestID, err := insights.Upload(ctx, archive, contentType, cmd.Duration("upload-timeout"))
+	insights.AuditArchiveUpload(insights.CollectionID(archive), contentType,
+		insights.IngressURL(), archive, requestID, err)
+	if err != nil {
+		return err
+	}
+	if cmd.String("format") == "json" {
+		return printJSON(CollectorRunDTO{Success: true, RequestID: requestID, Archive: path})
+	}
+	if requestID != "" {
+		fmt.Printf("%s: uploaded (request %s)\n", path, requestID)
+	} else {
+		fmt.Printf("%s: uploaded\n", path)
+	}
+	return nil
+}
+
+// printRunHuman prints the human-readable outcome of one run.
+func printRunHuman(id string, result insights.RunResult, opts insights.RunOptions) {
+	collected := roundDuration(result.CollectDuration)
+	uploaded := roundDuration(result.UploadDuration)
+	switch {
+	case result.Skipped:
+		fmt.Printf("%s: skipped, too many recent upload failures\n", id)
+	case result.Unchanged:
+		fmt.Printf("%s: unchanged, skipped upload (collected in %s)\n", id, collected)
+	case opts.NoUpload:
+		fmt.Printf("%s: collected in %s\n", id, collected)
+	case result.RequestID != "":
+		fmt.Printf("%s: collected in %s, uploaded in %s (request %s)\n",
+			id, collected, uploaded, result.RequestID)
+	default:
+		fmt.Printf("%s: collected in %s, uploaded in %s\n", id, collected, uploaded)
+	}
+	if result.Archive != "" {
+		fmt.Printf("%s: archive kept at %s (sha256 %s)\n", id, result.Archive, result.Checksum)
+	}
+}
+
+// roundDuration trims a duration to a precision worth reading: whole
+// seconds once minutes are involved, fractions of a second below
+// that.
+func roundDuration(d time.Duration) time.Duration {
+	switch {
+	case d >= time.Minute:
+		return d.Round(time.Second)
+	case d >= time.Second:
+		return d.Round(10 * time.Millisecond)
+	default:
+		return d.Round(100 * time.Microsecond)
+	}
+}
+
+// CollectorRunDTO describes the outcome of one collector run in
+// machine-readable output.
+type CollectorRunDTO struct {
+	ID string `json:"id"`
+	// Command is the effective argument vector the collector ran,
+	// extra arguments included.
+	Command   []string `json:"command,omitempty"`
+	Success   bool     `json:"success"`
+	RequestID string   `json:"request-id,omitempty"`
+	Archive   string   `json:"archive,omitempty"`
+	// Checksum is the archive's SHA-256 digest, sent as the upload's
+	// idempotency key with every attempt.
+	Checksum string `json:"checksum,omitempty"`
+	// Manifest lists the files packed into the archive.
+	Manifest []string `json:"manifest,omitempty"`
+	// ManifestDetail lists each collected file with its size and
+	// SHA-256 digest, as recorded in the archive's manifest.json. It
+	// is included with --show-manifest.
+	ManifestDetail []insights.ManifestEntry `json:"manifest-detail,omitempty"`
+	// ArchiveTree is the collected files as a directory tree,
+	// included with --print-archive-tree.
+	ArchiveTree []*TreeNodeDTO `json:"archive-tree,omitempty"`
+	// Unchanged marks a run whose upload was skipped because the
+	// collected data matched the previous upload.
+	Unchanged bool `json:"unchanged,omitempty"`
+	// Skipped marks a scheduled run that was skipped because the
+	// upload circuit breaker was open.
+	Skipped bool `json:"skipped,omitempty"`
+	// CollectDurationSeconds and UploadDurationSeconds time the two
+	// expensive pipeline stages; the upload time is total wall time
+	// across all attempts.
+	CollectDurationSeconds float64 `json:"collect-duration-seconds"`
+	UploadDurationSeconds  float64 `json:"upload-duration-seconds,omitempty"`
+	// UploadAttempts counts the upload attempts made and
+	// LastUploadDurationSeconds times only the final one.
+	UploadAttempts            int     `json:"upload-attempts,omitempty"`
+	LastUploadDurationSeconds float64 `json:"last-upload-duration-seconds,omitempty"`
+	// InvocationID is the systemd invocation ID of the process, set
+	// when the run happens under a systemd unit, so the DTO can be
+	// correlated with the matching journal entry.
+	InvocationID string `json:"invocation-id,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
+// runOptionsFromFlags reads the run flags off the command.
+func runOptionsFromFlags(cmd *cli.Command) insights.RunOptions {
+	return insights.RunOptions{
+		MaxArchiveSize:   cmd.Int("max-size"),
+		Keep:             cmd.Bool("keep"),
+		KeepOnFailure:    cmd.Bool("keep-on-failure"),
+		KeepUploaded:     cmd.Bool("keep-uploaded"),
+		NoUpload:         cmd.Bool("no-upload"),
+		OnlyIfChanged:    cmd.Bool("upload-only-if-changed"),
+		Force:            cmd.Bool("force"),
+		UploadTimeout:    cmd.Duration("upload-timeout"),
+		MetricsDir:       cmd.String("metrics-dir"),
+		AuditLog:         cmd.String("audit-log"),
+		CompressionLevel: int(cmd.Int("compression-level")),
+		Reproducible:     cmd.Bool("reproducible"),
+		Stream:           cmd.Bool("stream"),
+		// Timer-driven runs carry a systemd invocation ID; those
+		// respect the upload circuit breaker, manual runs bypass it.
+		Scheduled: os.Getenv("INVOCATION_ID") != "",
+		Wait:      cmd.Bool("wait"),
+	}
+}
+
+// FlushDTO describes the outcome of one spooled upload attempt in
+// machine-readable output.
+type FlushDTO struct {
+	Archive   string `json:"archive"`
+	Success   bool   `json:"success"`
+	RequestID string `json:"request-id,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+func runFlush(ctx context.Context, cmd *cli.Command) error {
+	insights.UploadRateLimit = cmd.Int("rate-limit")
+	spooled, err := insights.SpooledArchives()
+	if err != nil {
+		return err
+	}
+
+	var failed int
+	results := make([]FlushDTO, 0, len(spooled))
+	for _, s := range spooled {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("interrupted: %w", err)
+		}
+		target := s.URL
+		if target == "" {
+			target = insights.IngressURL()
+		}
+		requestID, err := insights.UploadTo(ctx, target, s.Path, s.ContentType, cmd.Duration("upload-timeout"))
+		// A flush delivers data a failed run only attempted; without a
+		// record here the audit log would say the data never left.
+		insights.AuditArchiveUpload(insights.CollectionID(s.Path), s.ContentType,
+			target, s.Path, requestID, err)
+		if err != nil {
+			failed++
+			slog.Warn("could not flush spooled archive", "archive", s.Path, "error", err)
+			results = append(results, FlushDTO{Archive: s.Path, Error: err.Error()})
+			continue
+		}
+		if err := s.Discard(); err != nil {
+			slog.Warn("could not discard spooled archive", "archive", s.Path, "error", err)
+		}
+		results = append(results, FlushDTO{Archive: s.Path, Success: true, RequestID: requestID})
+	}
+
+	if cmd.String("format") == "json" {
+		if err := printJSON(results); err != nil {
+			return err
+		}
+	} else {
+		fmt.Printf("%d of %d spooled archives uploaded\n", len(spooled)-failed, len(spooled))
+	}
+	if failed > 0 {
+		return fmt.Errorf("%w: %d spooled archives could not be uploaded", insights.ErrUpload, failed)
+	}
+	return nil
+}
+
+// removeAll deletes path and logs a warning when that fails.
+func removeAll(path string) {
+	if err := os.RemoveAll(path); err != nil {
+		slog.Warn("could not clean up", "path", path, "error", err)
+	}
+}
+
+func runEnable(ctx context.Context, cmd *cli.Command) error {
+	id, err := argumentID(cmd)
+	if err != nil {
+		return err
+	}
+	if _, err := insights.GetCollector(id); err != nil {
+		return err
+	}
+	delay, err := randomizedDelay(cmd)
+	if err != nil {
+		return err
+	}
+	return insights.EnableTimer(id, userScope(cmd), delay)
+}
+
+// randomizedDelay resolves the timer jitter to enable with: the
+// --randomized-delay flag, or the configuration file's [systemd]
+// section.
+func randomizedDelay(cmd *cli.Command) (time.Duration, error) {
+	if cmd.IsSet("randomized-delay") {
+		return cmd.Duration("randomized-delay"), nil
+	}
+	configured := insights.CurrentConfig().Systemd.RandomizedDelay
+	if configured == "" {
+		return 0, nil
+	}
+	delay, err := time.ParseDuration(configured)
+	if err != nil {
+		return 0, fmt.Errorf("%w: invalid systemd.randomized-delay %q: %w",
+			insights.ErrConfig, configured, err)
+	}
+	return delay, nil
+}
+
+func runDisable(ctx context.Context, cmd *cli.Command) error {
+	id, err := argumentID(cmd)
+	if err != nil {
+		return err
+	}
+	if _, err := insights.GetCollector(id); err != nil {
+		return err
+	}
+	user := userScope(cmd)
+	if err := insights.DisableTimer(id, user, cmd.Bool("now")); err != nil {
+		return err
+	}
+	if cmd.String("format") == "json" {
+		// Report the state the timer actually ended up in: with
+		// --now=false it stays active until the next boot.
+		timer, err := insights.GetTimer(id, user)
+		if err != nil {
+			return err
+		}
+		return printJSON(timer)
+	}
+	return nil
+}
+
+func runStatus(ctx context.Context, cmd *cli.Command) error {
+	id, err := argumentID(cmd)
+	if err != nil {
+		return err
+	}
+	if _, err := insights.GetCollector(id); err != nil {
+		return err
+	}
+	timer, err := insights.GetTimer(id, userScope(cmd))
+	if err != nil {
+		return err
+	}
+	last, err := insights.GetLastRun(id)
+	if err != nil {
+		return err
+	}
+
+	if cmd.String("format") == "json" {
+		return printJSON(struct {
+			ID      string           `json:"id"`
+			Timer   insights.Timer   `json:"timer"`
+			LastRun insights.LastRun `json:"last_run"`
+		}{ID: id, Timer: timer, LastRun: last})
+	}
+
+	fmt.Printf("ID:       %s\n", id)
+	if timer.Loaded {
+		fmt.Printf("Timer:    %s, %s\n",
+			enabledString(timer.Enabled), activeString(timer.Active))
+	} else {
+		fmt.Printf("Timer:    %s is not installed\n", timer.Unit)
+	}
+	fmt.Printf("Last run: %s\n", lastRunString(last))
+	fmt.Printf("Next run: %s\n", formatTime(timer.NextTrigger))
+	return nil
+}
+
+// enabledString renders a timer's enablement state.
+func enabledString(enabled bool) string {
+	if enabled {
+		return colorize(ansiGreen, "enabled")
+	}
+	return colorize(ansiYellow, "disabled")
+}
+
+// activeString renders a timer's activation state.
+func activeString(active bool) string {
+	if active {
+		return colorize(ansiGreen, "active")
+	}
+	return colorize(ansiYellow, "inactive")
+}
+
+// lastRunString renders a last-run record for human output.
+func lastRunString(last insights.LastRun) string {
+	if last.Time.IsZero() {
+		return "never"
+	}
+	switch {
+	case last.ExitStatus < 0:
+		return fmt.Sprintf("%s (outcome unknown)", formatTime(last.Time))
+	case last.Succeeded():
+		return fmt.Sprintf("%s (succeeded)", formatTime(last.Time))
+	default:
+		return fmt.Sprintf("%s (failed, exit status %d)",
+			formatTime(last.Time), last.ExitStatus)
+	}
+}
+
+// parseTimeRef parses a point in time given either as an absolute
+// timestamp or as a duration counted back from now (e.g. "24h").
+func parseTimeRef(value string) (time.Time, error) {
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("could not parse time %q", value)
+}
+
+// lastRunResult renders a short last-run outcome for table output.
+func lastRunResult(last insights.LastRun) string {
+	switch {
+	case last.Time.IsZero():
+		return "never"
+	case last.ExitStatus < 0:
+		return "unknown"
+	case last.Succeeded():
+		return "ok"
+	default:
+		return "failed"
+	}
+}
+
+func runTimers(ctx context.Context, cmd *cli.Command) error {
+	if !insights.SchedulingAvailable() {
+		return insights.ErrNoSystemd
+	}
+	collectors, err := insights.GetCollectors()
+	if err != nil {
+		return err
+	}
+
+	var since, until time.Time
+	if value := cmd.String("since"); value != "" {
+		if since, err = parseTimeRef(value); err != nil {
+			return err
+		}
+	}
+	if value := cmd.String("until"); value != "" {
+		if until, err = parseTimeRef(value); err != nil {
+			return err
+		}
+	}
+
+	type timerRow struct {
+		ID string `json:"id"`
+		insights.Timer
+		LastRun insights.LastRun `json:"last_run"`
+	}
+	var rows []timerRow
+	for _, c := range collectors {
+		if match, err := labelMatch(cmd.StringSlice("label"), c); err != nil {
+			return err
+		} else if !match {
+			continue
+		}
+		timer, err := insights.GetTimer(c.Meta.ID, userScope(cmd))
+		if err != nil {
+			return err
+		}
+		last, err := insights.GetLastRun(c.Meta.ID)
+		if err != nil {
+			return err
+		}
+		if !since.IsZero() && last.Time.Before(since) {
+			continue
+		}
+		if !until.IsZero() && last.Time.After(until) {
+			continue
+		}
+		if cmd.Bool("failed-only") && (last.Time.IsZero() || last.ExitStatus <= 0) {
+			continue
+		}
+		rows = append(rows, timerRow{ID: c.Meta.ID, Timer: timer, LastRun: last})
+	}
+
+	if cmd.String("format") == "json" {
+		return printJSON(rows)
+	}
+	if cmd.String("format") == "csv" {
+		records := make([][]string, 0, len(rows))
+		for _, row := range rows {
+			records = append(records, []string{
+				row.ID,
+				strconv.FormatBool(row.Enabled), strconv.FormatBool(row.Active),
+				formatTime(row.LastRun.Time), lastRunResult(row.LastRun),
+				formatTime(row.NextTrigger),
+			})
+		}
+		return writeCSV([]string{"id", "enabled", "active", "last", "result", "next"},
+			records, false)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tENABLED\tACTIVE\tLAST\tRESULT\tNEXT")
+	for _, row := range rows {
+		fmt.Fprintf(w, "%s\t%t\t%t\t%s\t%s\t%s\n",
+			row.ID, row.Enabled, row.Active,
+			formatTime(row.LastRun.Time), lastRunResult(row.LastRun),
+			formatTime(row.NextTrigger))
+	}
+	return w.Flush()
+}
+
+// writeCSV emits the rows as RFC 4180 CSV on stdout, preceded by a
+// header row unless suppressed, for spreadsheets and fleet tooling
+// that chokes on elastic tabs.
+func writeCSV(header []string, rows [][]string, noHeader bool) error {
+	w := csv.NewWriter(os.Stdout)
+	if !noHeader {
+		if err := w.Write(header); err != nil {
+			return err
+		}
+	}
+	for _, row := range rows {
+		if err := w.Write(row); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// useUTC switches human-readable timestamps to UTC; set by the
+// global --utc flag.
+var useUTC bool
+
+// formatTime renders a timestamp for human output, using "never" for
+// the zero time. The timezone is always spelled out, so operators in
+// different timezones reading the same output cannot misread it;
+// --utc renders in UTC instead of local time.
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	if useUTC {
+		t = t.UTC()
+	}
+	return t.Format("2006-01-02 15:04:05 MST")
+}
+
+// GCDTO describes one stale collection handled by gc.
+type GCDTO struct {
+	Path    string `json:"path"`
+	Removed bool   `json:"removed"`
+}
+
+func runGC(ctx context.Context, cmd *cli.Command) error {
+	stale, err := insights.StaleCollections(cmd.Duration("older-than"))
+	if err != nil {
+		return err
+	}
+
+	dryRun := cmd.Bool("dry-run")
+	results := make([]GCDTO, 0, len(stale))
+	for _, path := range stale {
+		if !dryRun {
+			if err := os.RemoveAll(path); err != nil {
+				return fmt.Errorf("could not remove %s: %w", path, err)
+			}
+		}
+		results = append(results, GCDTO{Path: path, Removed: !dryRun})
+	}
+
+	if cmd.String("format") == "json" {
+		return printJSON(results)
+	}
+	for _, result := range results {
+		fmt.Println(result.Path)
+	}
+	if dryRun {
+		fmt.Printf("%d stale collections would be removed\n", len(results))
+	} else {
+		fmt.Printf("%d stale collections removed\n", len(results))
+	}
+	return nil
+}
+
+// statusString renders a doctor check status for human output.
+func statusString(status insights.CheckStatus) string {
+	label := strings.ToUpper(string(status))
+	switch status {
+	case insights.CheckPass:
+		return colorize(ansiGreen, label)
+	case insights.CheckWarn:
+		return colorize(ansiYellow, label)
+	default:
+		return colorize(ansiRed, label)
+	}
+}
+
+func runDoctor(ctx context.Context, cmd *cli.Command) error {
+	checks := insights.Doctor(ctx)
+
+	failed := 0
+	for _, check := range checks {
+		if check.Status == insights.CheckFail {
+			failed++
+		}
+	}
+
+	if cmd.String("format") == "json" {
+		if err := printJSON(checks); err != nil {
+			return err
+		}
+	} else {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		for _, check := range checks {
+			fmt.Fprintf(w, "%s\t%s\t%s\n",
+				statusString(check.Status), check.Name, check.Detail)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d check(s) failed", failed)
+	}
+	return nil
+}
+
+// SettingDTO is one effective configuration value and the place it
+// was resolved from.
+type SettingDTO struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Source string `json:"source"`
+}
+
+// resolveSource names where a setting's value came from: the first
+// set environment variable, the configuration file, or the built-in
+// default.
+func resolveSource(fileValue string, envNames ...string) string {
+	for _, name := range envNames {
+		if os.Getenv(name) != "" {
+			return "environment (" + name + ")"
+		}
+	}
+	if fileValue != "" {
+		return "file"
+	}
+	return "default"
+}
+
+// redactProxy hides the password of a proxy URL so show-config output
+// is safe to paste into a support case.
+func redactProxy(proxy string) string {
+	if proxy == "" {
+		return ""
+	}
+	u, err := url.Parse(proxy)
+	if err != nil {
+		return proxy
+	}
+	return u.Redacted()
+}
+
+func runShowConfig(ctx context.Context, cmd *cli.Command) error {
+	config := insights.CurrentConfig()
+	certFile, keyFile := insights.CertPaths()
+
+	proxy := config.Proxy
+	proxySource := resolveSource(config.Proxy)
+	if proxy == "" {
+		for _, name := range []string{"HTTPS_PROXY", "https_proxy", "HTTP_PROXY", "http_proxy"} {
+			if value := os.Getenv(name); value != "" {
+				proxy, proxySource = value, "environment ("+name+")"
+				break
+			}
+		}
+	}
+
+	logLevel, logSource := "warn", "default"
+	switch {
+	case cmd.Root().IsSet("quiet") && cmd.Root().Bool("quiet"):
+		logLevel, logSource = "error", "flag"
+	case cmd.Root().IsSet("debug") && cmd.Root().Bool("debug"):
+		logLevel, logSource = "debug", "flag"
+	case os.Getenv("RHC_DEBUG") != "":
+		logLevel, logSource = "debug", "environment (RHC_DEBUG)"
+	case config.LogLevel != "":
+		logLevel, logSource = config.LogLevel, "file"
+	}
+
+	settings := []SettingDTO{
+		{"config-dir", strings.Join(insights.ConfigDirs(), string(os.PathListSeparator)),
+			resolveSource(config.ConfigDir, "CONFIG_DIR")},
+		{"cache-dir", insights.CacheDir(), resolveSource(config.CacheDir, "CACHE_DIR")},
+		{"collections-dir", insights.CollectionsDir(), resolveSource(config.CollectionsDir, "COLLECTIONS_DIR")},
+		{"ingress-url", insights.IngressURL(), resolveSource(config.IngressURL, "INGRESS_URL")},
+		{"proxy", redactProxy(proxy), proxySource},
+		{"cert-file", certFile, resolveSource(config.CertFile)},
+		{"key-file", keyFile, resolveSource(config.KeyFile)},
+		{"consumer-uuid", insights.ConsumerUUID(), "certificate"},
+		{"log-level", logLevel, logSource},
+	}
+
+	if cmd.String("format") == "json" {
+		return printJSON(settings)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tVALUE\tSOURCE")
+	for _, s := range settings {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", s.Name, s.Value, s.Source)
+	}
+	return w.Flush()
+}
+
+func runJournal(ctx context.Context, cmd *cli.Command) error {
+	id, err := argumentID(cmd)
+	if err != nil {
+		return err
+	}
+	journal := exec.Command(
+		"journalctl", "--no-pager", "-u", insights.ServiceUnit(id),
+	)
+	journal.Stdout = os.Stdout
+	journal.Stderr = os.Stderr
+	return journal.Run()
+}
@@ -0,0 +1,38 @@
+package main
+
+import "os"
+
+// ANSI escape sequences for the few colors human output uses.
+const (
+	ansiGreen  = "\x1b[32m"
+	ansiYellow = "\x1b[33m"
+	ansiRed    = "\x1b[31m"
+	ansiReset  = "\x1b[0m"
+)
+
+// colorEnabled gates colored human output. It is set once flags are
+// parsed.
+var colorEnabled bool
+
+// configureColor decides whether human output may use color:
+// disabled by the --no-color flag, the NO_COLOR convention
+// (https://no-color.org), or stdout not being a terminal, so CI logs
+// and pipelines never see escape sequences.
+func configureColor(noColor bool) {
+	colorEnabled = !noColor && os.Getenv("NO_COLOR") == "" && isTerminal(os.Stdout)
+}
+
+// isTerminal reports whether f is attached to a terminal.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// colorize wraps s in the given ANSI color when colored output is
+// enabled, and returns it unchanged otherwise.
+func colorize(color, s string) string {
+	if !colorEnabled {
+		return s
+	}
+	return color + s + ansiReset
+}
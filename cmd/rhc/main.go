@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/urfave/cli/v3"
+
+	insights "github.com/RedHatInsights/rhc-insights"
+)
+
+// Version is the version of the rhc binary. It is overridden at build
+// time with -ldflags.
+var Version = "devel"
+
+// configureLogging installs the default logger. Verbose lowers the
+// level to info and debug lowers it further; quiet raises it to error
+// and wins over both.
+func configureLogging(debug, verbose, quiet bool) {
+	level := slog.LevelWarn
+	if verbose {
+		level = slog.LevelInfo
+	}
+	if debug {
+		level = slog.LevelDebug
+	}
+	if quiet {
+		level = slog.LevelError
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: level,
+	}))
+	// Under a systemd unit, stamp every record with the invocation
+	// ID so log lines can be correlated with the journal entry of
+	// the run that produced them.
+	if id := os.Getenv("INVOCATION_ID"); id != "" {
+		logger = logger.With("invocation_id", id)
+	}
+	slog.SetDefault(logger)
+}
+
+func main() {
+	// Bootstrap logging from the environment so messages emitted
+	// before flag parsing are not lost; the Before hook reconfigures
+	// it once cli has parsed the real --debug flag.
+	configureLogging(os.Getenv("RHC_DEBUG") != "", false, false)
+
+	cmd := &cli.Command{
+		Name:    "rhc",
+		Usage:   "Interact with Red Hat services",
+		Version: Version,
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  "debug",
+				Usage: "enable debug logging",
+			},
+			&cli.BoolFlag{
+				Name:    "verbose",
+				Aliases: []string{"v"},
+				Usage:   "enable progress logging, e.g. each file added to an archive",
+			},
+			&cli.BoolFlag{
+				Name:    "quiet",
+				Aliases: []string{"q"},
+				Usage:   "suppress progress messages and non-error logs",
+			},
+			&cli.StringFlag{
+				Name:  "config",
+				Usage: "path to the global configuration file",
+				Value: insights.DefaultConfigPath,
+			},
+			&cli.BoolFlag{
+				Name:  "strict",
+				Usage: "treat recoverable collector definition problems as errors",
+			},
+			&cli.BoolFlag{
+				Name:  "no-color",
+				Usage: "disable colored output (also honored via the NO_COLOR environment variable)",
+			},
+			&cli.BoolFlag{
+				Name:  "pretty",
+				Usage: "indent JSON output (default: only when stdout is a terminal)",
+			},
+			&cli.BoolFlag{
+				Name:  "utc",
+				Usage: "render human-readable timestamps in UTC instead of local time",
+			},
+		},
+		Before: func(ctx context.Context, cmd *cli.Command) (context.Context, error) {
+			if err := insights.LoadConfig(cmd.String("config")); err != nil {
+				return ctx, err
+			}
+			insights.Strict = cmd.Bool("strict")
+			configureColor(cmd.Bool("no-color"))
+			if cmd.IsSet("pretty") {
+				prettyJSON = cmd.Bool("pretty")
+			} else {
+				prettyJSON = isTerminal(os.Stdout)
+			}
+			debug := cmd.Bool("debug") ||
+				strings.EqualFold(insights.CurrentConfig().LogLevel, "debug")
+			configureLogging(debug, cmd.Bool("verbose"), cmd.Bool("quiet"))
+			useUTC = cmd.Bool("utc")
+			return ctx, nil
+		},
+		Commands: []*cli.Command{
+			collectorCommand,
+			versionCommand,
+		},
+	}
+
+	// Cancel the context on SIGINT/SIGTERM so a run can stop between
+	// collectors instead of dying mid-archive; a second signal kills
+	// the process the usual way.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		// NotifyContext keeps swallowing signals after the first one
+		// cancels the context; restore the default handler so the
+		// second signal behaves as promised above.
+		<-ctx.Done()
+		stop()
+	}()
+
+	if err := cmd.Run(ctx, os.Args); err != nil {
+		code := exitCode(err)
+		if jsonFormatRequested() {
+			data, _ := json.Marshal(struct {
+				Error string `json:"error"`
+				Code  int    `json:"code"`
+			}{Error: err.Error(), Code: code})
+			fmt.Println(string(data))
+		} else {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		}
+		os.Exit(code)
+	}
+}
+
+// jsonFormatRequested reports whether the invocation asked for JSON
+// output. Errors can surface before (or while) flags are parsed, so
+// the raw arguments are inspected rather than the parsed command.
+func jsonFormatRequested() bool {
+	for i, arg := range os.Args {
+		if arg == "--format=json" {
+			return true
+		}
+		if arg == "--format" && i+1 < len(os.Args) && os.Args[i+1] == "json" {
+			return true
+		}
+	}
+	return false
+}
+
+// Exit codes returned by the rhc binary, so automation can tell
+// failure categories apart without scraping error text.
+const (
+	exitErr              = 1
+	exitCollectorMissing = 2
+	exitCollectFailed    = 3
+	exitUploadFailed     = 4
+	exitConfigInvalid    = 5
+	exitBusy             = 6
+	exitNoSystemd        = 7
+	// exitInterrupted follows the shell convention of 128+SIGINT for
+	// runs stopped by a signal.
+	exitInterrupted = 130
+)
+
+// exitCode maps an error to the binary's exit code.
+func exitCode(err error) int {
+	switch {
+	// An interrupted run may wrap the cancellation in a collect or
+	// upload error; the interrupt is what the operator caused, so it
+	// wins over the category codes.
+	case errors.Is(err, context.Canceled):
+		return exitInterrupted
+	case errors.Is(err, insights.ErrCollectorNotFound):
+		return exitCollectorMissing
+	case errors.Is(err, insights.ErrCollect):
+		return exitCollectFailed
+	case errors.Is(err, insights.ErrUpload):
+		return exitUploadFailed
+	case errors.Is(err, insights.ErrConfig):
+		return exitConfigInvalid
+	case errors.Is(err, insights.ErrBusy):
+		return exitBusy
+	case errors.Is(err, insights.ErrNoSystemd):
+		return exitNoSystemd
+	}
+	return exitErr
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+
+	"github.com/urfave/cli/v3"
+)
+
+// Commit and BuildDate identify the exact build. Like Version they
+// are overridden at build time with -ldflags; a local build reports
+// them as unknown.
+var (
+	Commit    = "unknown"
+	BuildDate = "unknown"
+)
+
+// VersionDTO describes the binary's build metadata in
+// machine-readable output.
+type VersionDTO struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"build-date"`
+	GoVersion string `json:"go-version"`
+}
+
+var versionCommand = &cli.Command{
+	Name:   "version",
+	Usage:  "Show the version and build metadata",
+	Flags:  []cli.Flag{formatFlag()},
+	Action: runVersion,
+}
+
+func runVersion(ctx context.Context, cmd *cli.Command) error {
+	dto := VersionDTO{
+		Version:   Version,
+		Commit:    Commit,
+		BuildDate: BuildDate,
+		GoVersion: runtime.Version(),
+	}
+	if cmd.String("format") == "json" {
+		return printJSON(dto)
+	}
+	fmt.Printf("rhc %s\n", dto.Version)
+	fmt.Printf("  commit:     %s\n", dto.Commit)
+	fmt.Printf("  built:      %s\n", dto.BuildDate)
+	fmt.Printf("  go version: %s\n", dto.GoVersion)
+	return nil
+}
@@ -0,0 +1,389 @@
+package insights
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// wOK is the write-permission bit for syscall.Access (W_OK), which
+// the syscall package does not export.
+const wOK = 0x2
+
+// CheckCommand verifies that every command the collector would run
+// resolves to an executable, so a typo in exec.command or exec.steps
+// surfaces as a clear error instead of a generic exec failure.
+func (c Collector) CheckCommand() error {
+	commands := c.commands()
+	if len(c.Exec.Post) > 0 {
+		commands = append(commands, c.Exec.Post)
+	}
+	for _, argv := range commands {
+		if _, err := exec.LookPath(argv[0]); err != nil {
+			return fmt.Errorf("%w: collector command not found: %s",
+				ErrConfig, argv[0])
+		}
+	}
+	return nil
+}
+
+// commands returns the collector's argument vectors in execution
+// order: the steps list when one is given, otherwise the single
+// command.
+func (c Collector) commands() [][]string {
+	if len(c.Exec.Steps) > 0 {
+		return c.Exec.Steps
+	}
+	return [][]string{c.Exec.Command}
+}
+
+// outputEnvName returns the environment variable the collector reads
+// the output directory from: exec.output_env when set,
+// COLLECTION_DIRECTORY otherwise.
+func outputEnvName(c Collector) string {
+	if c.Exec.OutputEnv != "" {
+		return c.Exec.OutputEnv
+	}
+	return "COLLECTION_DIRECTORY"
+}
+
+// defaultEnvPassthrough is the minimal set of parent environment
+// variables a collector inherits when exec.env_passthrough does not
+// say otherwise. Anything beyond it — tokens, cloud credentials —
+// must be asked for explicitly.
+var defaultEnvPassthrough = []string{"PATH", "LANG"}
+
+// matchesEnv reports whether the variable name matches any of the
+// names or filepath.Match patterns. The patterns were validated when
+// the definition was loaded.
+func matchesEnv(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if match, _ := filepath.Match(pattern, name); match {
+			return true
+		}
+	}
+	return false
+}
+
+// collectorEnv builds the environment for a collector's command: the
+// parent variables allowed through by exec.env_passthrough minus
+// exec.env_block (none at all under exec.clear-env), the variables
+// from [exec.env] with ${VAR} references expanded against the parent
+// environment, and the collection directory.
+func collectorEnv(c Collector, directory string) []string {
+	var env []string
+	if !c.Exec.ClearEnv {
+		allowed := c.Exec.EnvPassthrough
+		if len(allowed) == 0 {
+			allowed = defaultEnvPassthrough
+		}
+		for _, entry := range os.Environ() {
+			name, _, _ := strings.Cut(entry, "=")
+			if !matchesEnv(allowed, name) || matchesEnv(c.Exec.EnvBlock, name) {
+				continue
+			}
+			env = append(env, entry)
+		}
+	}
+	names := make([]string, 0, len(c.Exec.Env))
+	for name := range c.Exec.Env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		env = append(env, name+"="+os.Expand(c.Exec.Env[name], os.Getenv))
+	}
+	return append(env, outputEnvName(c)+"="+directory)
+}
+
+// CollectInTmpfs backs every collection directory with a tmpfs
+// mount, regardless of the collector's exec.tmpfs setting. It is set
+// by the --tmpfs flag.
+var CollectInTmpfs bool
+
+// tmpfsBacked reports whether the collector's collection directory
+// is backed by tmpfs, through its own exec.tmpfs or the global
+// CollectInTmpfs.
+func tmpfsBacked(c Collector) bool {
+	return c.Exec.Tmpfs || CollectInTmpfs
+}
+
+// mountTmpfs mounts a private tmpfs over the collection directory so
+// the collected data lives in memory only. The mount is restricted
+// to the owner, like the directory itself.
+func mountTmpfs(directory string) error {
+	return syscall.Mount("tmpfs", directory, "tmpfs",
+		syscall.MS_NOSUID|syscall.MS_NODEV, "mode=0700")
+}
+
+// collectionNameRe matches the ID-timestamp names Collect gives to
+// collection directories, and the archives compressed from them.
+var collectionNameRe = regexp.MustCompile(`^(.+)-(\d+)(\.tar\.gz)?$`)
+
+// CollectionID derives the collector ID from a collection directory
+// or archive following Collect's ID-timestamp naming, for audit
+// records of uploads performed after the run. It returns an empty
+// string for paths named differently.
+func CollectionID(path string) string {
+	match := collectionNameRe.FindStringSubmatch(filepath.Base(path))
+	if match == nil {
+		return ""
+	}
+	return match[1]
+}
+
+// StaleCollections returns the collection directories, and leftover
+// archives, under CollectionsDir whose embedded timestamp is older
+// than the given age. Entries that do not follow Collect's
+// ID-timestamp naming are left alone.
+func StaleCollections(olderThan time.Duration) ([]string, error) {
+	entries, err := os.ReadDir(CollectionsDir())
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read collections directory: %w", err)
+	}
+
+	cutoff := time.Now().Add(-olderThan)
+	var stale []string
+	for _, entry := range entries {
+		match := collectionNameRe.FindStringSubmatch(entry.Name())
+		if match == nil {
+			continue
+		}
+		ts, err := strconv.ParseInt(match[2], 10, 64)
+		if err != nil {
+			continue
+		}
+		if time.Unix(ts, 0).Before(cutoff) {
+			stale = append(stale, filepath.Join(CollectionsDir(), entry.Name()))
+		}
+	}
+	return stale, nil
+}
+
+// scopeCommand returns the collector's argument vector, wrapped in a
+// transient systemd scope when [exec] sets a memory or CPU limit, so
+// a runaway collector cannot starve the host. Without systemd the
+// limits cannot be enforced and the command runs plain, with a
+// warning.
+func scopeCommand(c Collector, argv []string) []string {
+	if c.Exec.MemoryMax == "" && c.Exec.CPUQuota == "" {
+		return argv
+	}
+	if !systemdAvailable() {
+		slog.Warn("systemd is unavailable, running without resource limits",
+			"id", c.Meta.ID)
+		return argv
+	}
+	wrap := []string{"systemd-run", "--scope", "--quiet", "--collect"}
+	if os.Geteuid() != 0 {
+		wrap = append(wrap, "--user")
+	}
+	if c.Exec.MemoryMax != "" {
+		wrap = append(wrap, "--property=MemoryMax="+c.Exec.MemoryMax)
+	}
+	if c.Exec.CPUQuota != "" {
+		wrap = append(wrap, "--property=CPUQuota="+c.Exec.CPUQuota)
+	}
+	wrap = append(wrap, "--")
+	return append(wrap, argv...)
+}
+
+// ResolvedExec describes what Collect would actually run for a
+// collector, once extends, steps, [exec.env] expansion and
+// resource-limit wrapping are applied. It exists so info --resolve
+// can show the effective invocation without running anything.
+type ResolvedExec struct {
+	// Commands are the argument vectors in execution order, post hook
+	// included, each wrapped in its systemd-run scope when resource
+	// limits apply.
+	Commands [][]string `json:"commands"`
+	// WorkingDir is where the commands run; empty means the
+	// collection directory created at run time.
+	WorkingDir string `json:"working_dir,omitempty"`
+	// Env lists the environment additions beyond what the process
+	// inherits: the expanded [exec.env] variables and the collection
+	// directory.
+	Env []string `json:"env"`
+	// ClearEnv reports whether the inherited environment is dropped.
+	ClearEnv bool  `json:"clear_env,omitempty"`
+	UID      IDRef `json:"uid"`
+	GID      IDRef `json:"gid"`
+	// NoNetwork reports whether the commands run in an unconnected
+	// network namespace.
+	NoNetwork bool `json:"no_network,omitempty"`
+}
+
+// ResolveExec returns the effective invocation Collect would use for
+// the collector. It goes through the same helpers Collect itself
+// uses, so the answer cannot drift from the real behavior. The
+// collection directory does not exist yet and is shown as the
+// $COLLECTION_DIRECTORY placeholder.
+func ResolveExec(c Collector) ResolvedExec {
+	resolved := ResolvedExec{
+		WorkingDir: c.Exec.WorkingDir,
+		ClearEnv:   c.Exec.ClearEnv,
+		UID:        c.Exec.UID,
+		GID:        c.Exec.GID,
+		NoNetwork:  c.Exec.NoNetwork,
+	}
+	for _, argv := range c.commands() {
+		resolved.Commands = append(resolved.Commands, scopeCommand(c, argv))
+	}
+	if len(c.Exec.Post) > 0 {
+		resolved.Commands = append(resolved.Commands, scopeCommand(c, c.Exec.Post))
+	}
+	// Dropping the inherited environment leaves exactly the additions.
+	additions := c
+	additions.Exec.ClearEnv = true
+	resolved.Env = collectorEnv(additions, "$COLLECTION_DIRECTORY")
+	return resolved
+}
+
+// Collect runs the collector's command and returns the path to the
+// directory containing the collected data. The command is told where
+// to write through the COLLECTION_DIRECTORY environment variable. The
+// command is killed when ctx expires.
+//
+// When collection fails after the directory was created, the
+// directory is returned alongside the error, so the caller can decide
+// whether to keep the partial data for inspection or remove it.
+func Collect(ctx context.Context, c Collector) (string, error) {
+	if err := c.CheckCommand(); err != nil {
+		return "", err
+	}
+
+	directory := filepath.Join(
+		CollectionsDir(),
+		fmt.Sprintf("%s-%d", c.Meta.ID, time.Now().Unix()),
+	)
+	if err := os.MkdirAll(directory, 0o700); err != nil {
+		if errors.Is(err, fs.ErrPermission) {
+			return "", fmt.Errorf("%w: collections directory %s is not writable by uid %d",
+				ErrIO, CollectionsDir(), os.Getuid())
+		}
+		return "", fmt.Errorf("could not create collection directory: %w", err)
+	}
+	// MkdirAll succeeds on a pre-existing directory without checking
+	// access, so probe writability explicitly; hardened hosts hit
+	// this regularly and deserve a message naming the fix.
+	if err := syscall.Access(directory, wOK); err != nil {
+		return "", fmt.Errorf("%w: collection directory %s is not writable by uid %d",
+			ErrIO, directory, os.Getuid())
+	}
+
+	if tmpfsBacked(c) {
+		if err := mountTmpfs(directory); errors.Is(err, syscall.EPERM) {
+			slog.Warn("mounting tmpfs requires root, collecting on disk instead",
+				"id", c.Meta.ID)
+		} else if err != nil {
+			return directory, fmt.Errorf("could not mount tmpfs on %s: %w", directory, err)
+		}
+	}
+
+	workDir := directory
+	if c.Exec.WorkingDir != "" {
+		info, err := os.Stat(c.Exec.WorkingDir)
+		if err != nil || !info.IsDir() {
+			return directory, fmt.Errorf("%w: collector %s: working directory %s does not exist",
+				ErrConfig, c.Meta.ID, c.Exec.WorkingDir)
+		}
+		workDir = c.Exec.WorkingDir
+	}
+	var attr *syscall.SysProcAttr
+	if c.Exec.UID.ID != 0 || c.Exec.GID.ID != 0 {
+		attr = &syscall.SysProcAttr{
+			Credential: &syscall.Credential{Uid: c.Exec.UID.ID, Gid: c.Exec.GID.ID},
+		}
+		if err := os.Chown(directory, int(c.Exec.UID.ID), int(c.Exec.GID.ID)); err != nil {
+			return directory, fmt.Errorf("could not chown collection directory: %w", err)
+		}
+	}
+	if c.Exec.NoNetwork {
+		if attr == nil {
+			attr = &syscall.SysProcAttr{}
+		}
+		// A fresh network namespace has only a downed loopback
+		// interface, so the command cannot reach the network.
+		attr.Cloneflags |= syscall.CLONE_NEWNET
+	}
+
+	commands := c.commands()
+	for i, argv := range commands {
+		// Name the failing step so multi-step authors do not have to
+		// guess which command broke.
+		label := fmt.Sprintf("collector %s", c.Meta.ID)
+		if len(commands) > 1 {
+			label = fmt.Sprintf("collector %s: step %d/%d (%s)",
+				c.Meta.ID, i+1, len(commands), argv[0])
+		}
+		if err := runStep(ctx, c, argv, directory, workDir, attr, label); err != nil {
+			return directory, err
+		}
+	}
+	if len(c.Exec.Post) > 0 {
+		label := fmt.Sprintf("collector %s: post hook (%s)", c.Meta.ID, c.Exec.Post[0])
+		if err := runStep(ctx, c, c.Exec.Post, directory, workDir, attr, label); err != nil {
+			return directory, err
+		}
+	}
+	return directory, nil
+}
+
+// runStep runs one of the collector's commands into the collection
+// directory. label names the command in errors.
+func runStep(ctx context.Context, c Collector, argv []string, directory, workDir string, attr *syscall.SysProcAttr, label string) error {
+	wrapped := scopeCommand(c, argv)
+	cmd := exec.CommandContext(ctx, wrapped[0], wrapped[1:]...)
+	cmd.Env = collectorEnv(c, directory)
+	cmd.Dir = workDir
+	// Run the step in its own process group and cancel by signalling
+	// the group, so grandchildren of shell collectors die with the
+	// step instead of surviving the timeout.
+	stepAttr := &syscall.SysProcAttr{}
+	if attr != nil {
+		*stepAttr = *attr
+	}
+	stepAttr.Setpgid = true
+	cmd.SysProcAttr = stepAttr
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	slog.Debug("running collector", "id", c.Meta.ID, "command", argv)
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("%w: %s: collection timed out: %w",
+				ErrCollect, label, ctx.Err())
+		}
+		if c.Exec.NoNetwork && errors.Is(err, syscall.EPERM) {
+			return fmt.Errorf(
+				"%w: %s: could not unshare the network namespace, "+
+					"exec.no_network needs root or CAP_SYS_ADMIN: %w",
+				ErrCollect, label, err)
+		}
+		if stderr.Len() > 0 {
+			return fmt.Errorf("%w: %s: %w: %s",
+				ErrCollect, label, err, bytes.TrimSpace(stderr.Bytes()))
+		}
+		return fmt.Errorf("%w: %s: %w", ErrCollect, label, err)
+	}
+	return nil
+}
@@ -0,0 +1,214 @@
+package insights
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestCollect(t *testing.T) {
+	t.Setenv("COLLECTIONS_DIR", t.TempDir())
+
+	c := Collector{
+		Meta: MetaOptions{ID: "example", Enabled: true},
+		Exec: ExecOptions{
+			Command: []string{"/bin/sh", "-c", `echo data > "$COLLECTION_DIRECTORY/data.txt"`},
+		},
+	}
+
+	directory, err := Collect(context.Background(), c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(directory, "data.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(string(data)) != "data" {
+		t.Errorf("unexpected collected data: %q", data)
+	}
+}
+
+func TestCollectSteps(t *testing.T) {
+	t.Setenv("COLLECTIONS_DIR", t.TempDir())
+
+	c := Collector{
+		Meta: MetaOptions{ID: "steps", Enabled: true},
+		Exec: ExecOptions{
+			Steps: [][]string{
+				{"/bin/sh", "-c", `echo one > "$COLLECTION_DIRECTORY/one.txt"`},
+				{"/bin/sh", "-c", `echo two > "$COLLECTION_DIRECTORY/two.txt"`},
+			},
+		},
+	}
+
+	directory, err := Collect(context.Background(), c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"one.txt", "two.txt"} {
+		if _, err := os.Stat(filepath.Join(directory, name)); err != nil {
+			t.Errorf("step output %s missing: %v", name, err)
+		}
+	}
+
+	// The first failing step aborts the collection and is named in
+	// the error.
+	c.Exec.Steps = [][]string{
+		{"/bin/true"},
+		{"/bin/false"},
+		{"/bin/sh", "-c", `echo three > "$COLLECTION_DIRECTORY/three.txt"`},
+	}
+	_, err = Collect(context.Background(), c)
+	if err == nil {
+		t.Fatal("expected the failing step to abort the collection")
+	}
+	if !strings.Contains(err.Error(), "step 2/3") {
+		t.Errorf("error does not name the failing step: %v", err)
+	}
+}
+
+func TestCollectPostHook(t *testing.T) {
+	t.Setenv("COLLECTIONS_DIR", t.TempDir())
+
+	c := Collector{
+		Meta: MetaOptions{ID: "hooked", Enabled: true},
+		Exec: ExecOptions{
+			Command: []string{"/bin/sh", "-c", `echo data > "$COLLECTION_DIRECTORY/data.txt"`},
+			Post:    []string{"/bin/sh", "-c", `ls "$COLLECTION_DIRECTORY" > "$COLLECTION_DIRECTORY/manifest.txt"`},
+		},
+	}
+
+	directory, err := Collect(context.Background(), c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(directory, "manifest.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "data.txt") {
+		t.Errorf("post hook did not see the collected data: %q", data)
+	}
+
+	c.Exec.Post = []string{"/bin/false"}
+	_, err = Collect(context.Background(), c)
+	if err == nil {
+		t.Fatal("expected a failing post hook to fail the run")
+	}
+	if !strings.Contains(err.Error(), "post hook") {
+		t.Errorf("error does not name the post hook: %v", err)
+	}
+}
+
+func TestCollectorEnv(t *testing.T) {
+	t.Setenv("PARENT_VALUE", "from-parent")
+
+	c := Collector{
+		Exec: ExecOptions{
+			Command:  []string{"/bin/true"},
+			Env:      map[string]string{"EXTRA": "${PARENT_VALUE}-suffix"},
+			ClearEnv: true,
+		},
+	}
+
+	env := collectorEnv(c, "/tmp/collection")
+	want := []string{
+		"EXTRA=from-parent-suffix",
+		"COLLECTION_DIRECTORY=/tmp/collection",
+	}
+	if len(env) != len(want) {
+		t.Fatalf("unexpected environment: %v", env)
+	}
+	for i := range want {
+		if env[i] != want[i] {
+			t.Errorf("unexpected entry %d: %q != %q", i, env[i], want[i])
+		}
+	}
+}
+
+func TestCollectorEnvFiltering(t *testing.T) {
+	t.Setenv("SECRET_TOKEN", "hunter2")
+	t.Setenv("LANG", "C.UTF-8")
+
+	// By default only the safe minimal set passes through.
+	c := Collector{Exec: ExecOptions{Command: []string{"/bin/true"}}}
+	for _, entry := range collectorEnv(c, "/tmp/collection") {
+		if strings.HasPrefix(entry, "SECRET_TOKEN=") {
+			t.Error("secret leaked into the default environment")
+		}
+	}
+	if !slices.Contains(collectorEnv(c, "/tmp/collection"), "LANG=C.UTF-8") {
+		t.Error("LANG did not pass through by default")
+	}
+
+	// A passthrough pattern lets more in; a block pattern wins over it.
+	c.Exec.EnvPassthrough = []string{"SECRET_*"}
+	if !slices.Contains(collectorEnv(c, "/tmp/collection"), "SECRET_TOKEN=hunter2") {
+		t.Error("passthrough pattern did not admit the variable")
+	}
+	c.Exec.EnvBlock = []string{"SECRET_TOKEN"}
+	if slices.Contains(collectorEnv(c, "/tmp/collection"), "SECRET_TOKEN=hunter2") {
+		t.Error("blocked variable passed through")
+	}
+}
+
+func TestCollectorEnvOutputEnv(t *testing.T) {
+	c := Collector{
+		Exec: ExecOptions{
+			Command:   []string{"/bin/true"},
+			OutputEnv: "SOSREPORT_DIR",
+			ClearEnv:  true,
+		},
+	}
+
+	env := collectorEnv(c, "/tmp/collection")
+	if len(env) != 1 || env[0] != "SOSREPORT_DIR=/tmp/collection" {
+		t.Errorf("unexpected environment: %v", env)
+	}
+}
+
+func TestCollectWorkingDir(t *testing.T) {
+	t.Setenv("COLLECTIONS_DIR", t.TempDir())
+
+	// Relative paths default to the collection directory.
+	c := Collector{
+		Meta: MetaOptions{ID: "cwd", Enabled: true},
+		Exec: ExecOptions{
+			Command: []string{"/bin/sh", "-c", "pwd > where.txt"},
+		},
+	}
+	directory, err := Collect(context.Background(), c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(directory, "where.txt")); err != nil {
+		t.Errorf("relative output did not land in the collection directory: %v", err)
+	}
+
+	// A missing working directory is rejected before running.
+	c.Exec.WorkingDir = "/does/not/exist"
+	if _, err := Collect(context.Background(), c); err == nil {
+		t.Error("expected an error for a missing working directory")
+	}
+}
+
+func TestCollectCommandNotFound(t *testing.T) {
+	t.Setenv("COLLECTIONS_DIR", t.TempDir())
+
+	c := Collector{
+		Meta: MetaOptions{ID: "example", Enabled: true},
+		Exec: ExecOptions{Command: []string{"/does/not/exist"}},
+	}
+
+	_, err := Collect(context.Background(), c)
+	if err == nil {
+		t.Fatal("expected an error for a missing binary")
+	}
+	if !strings.Contains(err.Error(), "collector command not found") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
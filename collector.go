@@ -0,0 +1,554 @@
+// Package insights implements data collection for Red Hat Insights.
+//
+// Collectors are defined by TOML files along the ConfigDirs search
+// path. Each collector
+// describes a command that gathers data into a collection directory;
+// the directory is then compressed and uploaded to the Ingress service.
+package insights
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"math"
+	"net/url"
+	"os"
+	"os/user"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// envNameRe matches valid environment variable names.
+var envNameRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Collector describes a single data collector defined by a TOML file
+// in ConfigDir.
+type Collector struct {
+	// Extends names a base definition whose settings are merged in
+	// below this one, so collectors can share common exec settings.
+	// Relative paths are resolved against the definition's directory.
+	Extends string        `toml:"extends" json:"extends,omitempty"`
+	Meta    MetaOptions   `toml:"meta" json:"meta"`
+	Exec    ExecOptions   `toml:"exec" json:"exec"`
+	Upload  UploadOptions `toml:"upload" json:"upload"`
+	// Generated holds values derived at load time rather than read
+	// from the definition.
+	Generated GeneratedOptions `toml:"-" json:"generated"`
+}
+
+// GeneratedOptions holds values filled in while loading a collector.
+type GeneratedOptions struct {
+	// Path is the definition file the collector was loaded from.
+	Path string `json:"path"`
+}
+
+// MetaOptions describes the collector itself.
+type MetaOptions struct {
+	// ID is the unique name of the collector.
+	ID string `toml:"id" json:"id"`
+	// Feature is the name of the content feature the collector
+	// belongs to.
+	Feature string `toml:"feature" json:"feature"`
+	// Labels are free-form key-value tags ([meta.labels] in TOML)
+	// operators can group and filter collectors by, beyond the single
+	// feature field.
+	Labels map[string]string `toml:"labels" json:"labels,omitempty"`
+	// Enabled marks whether the collector takes part in scheduled
+	// and --all runs. Disabled collectors stay on disk and can still
+	// be run explicitly. Defaults to true.
+	Enabled bool `toml:"enabled" json:"enabled"`
+}
+
+// ExecOptions describes the command a collector runs.
+type ExecOptions struct {
+	// Command is the argument vector executed to collect data.
+	Command []string `toml:"command" json:"command"`
+	// Steps is an ordered list of argument vectors run sequentially
+	// into the same collection directory, for collectors that need
+	// several commands without wrapping them in a shell script. It is
+	// mutually exclusive with Command; the first failing step aborts
+	// the collection.
+	Steps [][]string `toml:"steps" json:"steps,omitempty"`
+	// Env holds extra environment variables for the command. Values
+	// may reference the parent environment with ${VAR}.
+	Env map[string]string `toml:"env" json:"env,omitempty"`
+	// ClearEnv starts the command with an empty environment instead
+	// of inheriting the parent's.
+	ClearEnv bool `toml:"clear-env" json:"clear-env"`
+	// EnvPassthrough lists the parent environment variables the
+	// command inherits, as names or filepath.Match patterns. When
+	// empty, only a safe minimal set (PATH, LANG) passes through, so
+	// credentials in the parent environment cannot leak into
+	// collectors.
+	EnvPassthrough []string `toml:"env_passthrough" json:"env_passthrough,omitempty"`
+	// EnvBlock strips parent environment variables, as names or
+	// filepath.Match patterns, even when EnvPassthrough would let
+	// them through.
+	EnvBlock []string `toml:"env_block" json:"env_block,omitempty"`
+	// OutputEnv is the name of the environment variable the command
+	// reads the output directory from, for collector scripts written
+	// against a different convention. Defaults to
+	// COLLECTION_DIRECTORY.
+	OutputEnv string `toml:"output_env" json:"output_env,omitempty"`
+	// WorkingDir is the directory the command runs in. When empty,
+	// the command runs in its collection directory so relative paths
+	// land in the archive.
+	WorkingDir string `toml:"working_dir" json:"working_dir,omitempty"`
+	// UID is the user the command runs as, given as a numeric ID or
+	// an account name. Zero means root.
+	UID IDRef `toml:"uid" json:"uid"`
+	// GID is the group the command runs as, given as a numeric ID or
+	// a group name. Zero means root.
+	GID IDRef `toml:"gid" json:"gid"`
+	// NoNetwork runs the command in a new, unconnected network
+	// namespace so it cannot reach the network while collecting.
+	// Requires root or CAP_SYS_ADMIN.
+	NoNetwork bool `toml:"no_network" json:"no_network"`
+	// Tmpfs backs the collection directory with a private tmpfs
+	// mount, so sensitive data never touches persistent storage
+	// before redaction. Requires root; without privileges the
+	// collection falls back to disk with a warning.
+	Tmpfs bool `toml:"tmpfs" json:"tmpfs"`
+	// AllowArgs lets a run append extra arguments from the command
+	// line to the command. Collectors must opt in so arguments cannot
+	// be injected into arbitrary definitions.
+	AllowArgs bool `toml:"allow_args" json:"allow_args"`
+	// MemoryMax caps the command's memory usage (systemd's MemoryMax,
+	// e.g. "512M"). The command runs in a transient scope when a limit
+	// is set; without systemd the limit is skipped with a warning.
+	MemoryMax string `toml:"memory_max" json:"memory_max,omitempty"`
+	// CPUQuota caps the command's CPU usage (systemd's CPUQuota, e.g.
+	// "50%"), enforced like MemoryMax.
+	CPUQuota string `toml:"cpu_quota" json:"cpu_quota,omitempty"`
+	// Post is an argument vector run after a successful collection
+	// and before redaction and compression, with the same
+	// COLLECTION_DIRECTORY, credentials and timeout as the main
+	// command — e.g. to build a manifest or sanitize output. A
+	// failing hook fails the run.
+	Post []string `toml:"post" json:"post,omitempty"`
+	// Redact describes data to strip from the collected directory
+	// before it is archived.
+	Redact RedactOptions `toml:"redact" json:"redact"`
+}
+
+// RedactOptions describes data stripped from a collection before it
+// is archived, for deployments with strict data-handling policies.
+type RedactOptions struct {
+	// ExcludeFiles lists globs of files to drop from the collected
+	// directory. A bare pattern like "*.key" matches at any depth.
+	ExcludeFiles []string `toml:"exclude-files" json:"exclude-files,omitempty"`
+	// ScrubPatterns lists regular expressions whose matches are
+	// replaced in the collected files.
+	ScrubPatterns []string `toml:"scrub-patterns" json:"scrub-patterns,omitempty"`
+}
+
+// IDRef is a numeric user or group ID that a definition can also
+// give by name. Names are resolved to their numeric ID when the
+// collector is loaded; the original name is kept for display.
+type IDRef struct {
+	// Name is the account or group name from the definition, when one
+	// was used.
+	Name string `json:"name,omitempty"`
+	// ID is the numeric ID.
+	ID uint32 `json:"id"`
+}
+
+// UnmarshalTOML accepts either an integer ID or a name.
+func (r *IDRef) UnmarshalTOML(value any) error {
+	switch v := value.(type) {
+	case int64:
+		if v < 0 || v > math.MaxUint32 {
+			return fmt.Errorf("id %d out of range", v)
+		}
+		r.ID = uint32(v)
+	case string:
+		r.Name = v
+	default:
+		return fmt.Errorf("invalid id %v", value)
+	}
+	return nil
+}
+
+// String renders the reference for display.
+func (r IDRef) String() string {
+	if r.Name != "" {
+		return fmt.Sprintf("%s (%d)", r.Name, r.ID)
+	}
+	return strconv.FormatUint(uint64(r.ID), 10)
+}
+
+// resolve fills in the numeric ID for a named reference. lookup maps
+// the name to its decimal ID, e.g. through os/user.
+func (r *IDRef) resolve(lookup func(string) (string, error)) error {
+	if r.Name == "" {
+		return nil
+	}
+	value, err := lookup(r.Name)
+	if err != nil {
+		return err
+	}
+	id, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		return err
+	}
+	r.ID = uint32(id)
+	return nil
+}
+
+// lookupUserID resolves a username to its decimal user ID.
+func lookupUserID(name string) (string, error) {
+	u, err := user.Lookup(name)
+	if err != nil {
+		return "", err
+	}
+	return u.Uid, nil
+}
+
+// lookupGroupID resolves a group name to its decimal group ID.
+func lookupGroupID(name string) (string, error) {
+	g, err := user.LookupGroup(name)
+	if err != nil {
+		return "", err
+	}
+	return g.Gid, nil
+}
+
+// UploadOptions describes how a collector's archive is uploaded.
+type UploadOptions struct {
+	// ContentType is the MIME type sent to Ingress so the archive is
+	// routed to the right service.
+	ContentType string `toml:"content-type" json:"content-type"`
+	// URL overrides the endpoint this collector's archives are sent
+	// to, for setups routing specific content away from the shared
+	// Ingress. Authentication stays the configured one. Must be
+	// https.
+	URL string `toml:"url" json:"url,omitempty"`
+}
+
+// collectorCache remembers parsed definitions keyed by path so that
+// repeated lookups within one process do not re-parse unchanged
+// files. Entries are invalidated when the file's size or modification
+// time changes.
+var collectorCache = struct {
+	sync.Mutex
+	entries map[string]collectorCacheEntry
+}{entries: map[string]collectorCacheEntry{}}
+
+type collectorCacheEntry struct {
+	modTime   time.Time
+	size      int64
+	collector Collector
+}
+
+// loadCollector returns the collector defined at path, reusing the
+// cached parse when the file is unchanged.
+func loadCollector(path string, info fs.FileInfo) (Collector, error) {
+	collectorCache.Lock()
+	defer collectorCache.Unlock()
+
+	if entry, ok := collectorCache.entries[path]; ok &&
+		entry.modTime.Equal(info.ModTime()) && entry.size == info.Size() {
+		return entry.collector, nil
+	}
+
+	c, err := newCollectorFromPath(path)
+	if err != nil {
+		delete(collectorCache.entries, path)
+		return c, err
+	}
+	collectorCache.entries[path] = collectorCacheEntry{
+		modTime:   info.ModTime(),
+		size:      info.Size(),
+		collector: c,
+	}
+	return c, nil
+}
+
+// errMissingID marks a definition without meta.id. GetCollectors
+// treats such files as shared bases rather than collectors.
+var errMissingID = errors.New("missing meta.id")
+
+// wrapDecodeError classifies a failed definition decode: errors from
+// the filesystem surface as ErrIO so callers can retry, while
+// everything else is a malformed definition.
+func wrapDecodeError(path string, err error) error {
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		return fmt.Errorf("%w: could not read %s: %w", ErrIO, path, err)
+	}
+	return fmt.Errorf("%w: could not parse %s: %w", ErrConfig, path, err)
+}
+
+// decodeCollectorFile decodes the definition at path into c, first
+// merging in the base named by its extends key so the child's own
+// keys override the base's. seen holds the paths already being
+// decoded and guards against include cycles.
+func decodeCollectorFile(path string, c *Collector, seen []string) error {
+	for _, previous := range seen {
+		if previous == path {
+			return fmt.Errorf("%w: include cycle: %s",
+				ErrConfig, strings.Join(append(seen, path), " -> "))
+		}
+	}
+	seen = append(seen, path)
+
+	var probe struct {
+		Extends string `toml:"extends"`
+	}
+	if _, err := toml.DecodeFile(path, &probe); err != nil {
+		return wrapDecodeError(path, err)
+	}
+	if probe.Extends != "" {
+		base := probe.Extends
+		if !filepath.IsAbs(base) {
+			base = filepath.Join(filepath.Dir(path), base)
+		}
+		if _, err := os.Stat(base); err != nil {
+			return fmt.Errorf("%w: %s: base definition %s does not exist",
+				ErrConfig, path, probe.Extends)
+		}
+		if err := decodeCollectorFile(base, c, seen); err != nil {
+			return err
+		}
+	}
+	if _, err := toml.DecodeFile(path, c); err != nil {
+		return wrapDecodeError(path, err)
+	}
+	return nil
+}
+
+// Strict upgrades recoverable definition problems, such as a file
+// name that does not match meta.id, from warnings to errors. It is
+// set by the command line's --strict flag.
+var Strict bool
+
+// newCollectorFromPath parses the collector definition at path.
+func newCollectorFromPath(path string) (Collector, error) {
+	c := Collector{Meta: MetaOptions{Enabled: true}}
+	if err := decodeCollectorFile(path, &c, nil); err != nil {
+		return c, err
+	}
+	if c.Meta.ID == "" {
+		return c, fmt.Errorf("%w: %s: %w", ErrConfig, path, errMissingID)
+	}
+	if name := strings.TrimSuffix(filepath.Base(path), ".toml"); name != c.Meta.ID {
+		// A foo.toml declaring meta.id = "bar" is listed as bar but
+		// easily confused with a collector named foo.
+		if Strict {
+			return c, fmt.Errorf("%w: %s: meta.id %q does not match the file name",
+				ErrConfig, path, c.Meta.ID)
+		}
+		slog.Warn("collector file name does not match meta.id",
+			"path", path, "id", c.Meta.ID)
+	}
+	if err := finishCollector(&c, path); err != nil {
+		return c, err
+	}
+	return c, nil
+}
+
+// finishCollector validates a decoded definition and stamps its
+// origin. origin names the definition in errors: the file for static
+// definitions, the generator executable for generated ones.
+func finishCollector(c *Collector, origin string) error {
+	if len(c.Exec.Command) == 0 && len(c.Exec.Steps) == 0 {
+		return fmt.Errorf("%w: %s: missing exec.command", ErrConfig, origin)
+	}
+	if len(c.Exec.Command) > 0 && len(c.Exec.Steps) > 0 {
+		return fmt.Errorf("%w: %s: exec.command and exec.steps are mutually exclusive",
+			ErrConfig, origin)
+	}
+	for i, argv := range c.Exec.Steps {
+		if len(argv) == 0 {
+			return fmt.Errorf("%w: %s: exec.steps[%d] is empty", ErrConfig, origin, i)
+		}
+	}
+	for name := range c.Exec.Env {
+		if !envNameRe.MatchString(name) {
+			return fmt.Errorf("%w: %s: invalid environment variable name %q",
+				ErrConfig, origin, name)
+		}
+	}
+	if err := c.Exec.UID.resolve(lookupUserID); err != nil {
+		return fmt.Errorf("%w: %s: unknown user %q: %w", ErrConfig, origin, c.Exec.UID.Name, err)
+	}
+	if err := c.Exec.GID.resolve(lookupGroupID); err != nil {
+		return fmt.Errorf("%w: %s: unknown group %q: %w", ErrConfig, origin, c.Exec.GID.Name, err)
+	}
+	for _, glob := range c.Exec.Redact.ExcludeFiles {
+		if _, err := filepath.Match(glob, ""); err != nil {
+			return fmt.Errorf("%w: %s: invalid exclude glob %q", ErrConfig, origin, glob)
+		}
+	}
+	for _, pattern := range append(c.Exec.EnvPassthrough, c.Exec.EnvBlock...) {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("%w: %s: invalid environment pattern %q", ErrConfig, origin, pattern)
+		}
+	}
+	for _, pattern := range c.Exec.Redact.ScrubPatterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("%w: %s: invalid scrub pattern %q: %w",
+				ErrConfig, origin, pattern, err)
+		}
+	}
+	if err := checkContentType(*c, origin); err != nil {
+		return err
+	}
+	if c.Upload.URL != "" {
+		u, err := url.Parse(c.Upload.URL)
+		if err != nil || u.Scheme != "https" {
+			return fmt.Errorf("%w: %s: upload.url must be an https URL, got %q",
+				ErrConfig, origin, c.Upload.URL)
+		}
+	}
+	c.Generated.Path = origin
+	return nil
+}
+
+// GetCollectors returns all collectors defined along ConfigDirs,
+// sorted by ID. Definitions from later directories override earlier
+// ones with the same ID, so admin drop-ins win over vendor defaults.
+func GetCollectors() ([]Collector, error) {
+	byID := make(map[string]Collector)
+	for _, dir := range ConfigDirs() {
+		entries, err := os.ReadDir(dir)
+		if errors.Is(err, fs.ErrNotExist) {
+			// Not every directory on the search path has to exist.
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: could not read collector directory: %w", ErrIO, err)
+		}
+		// Two files claiming the same ID within one directory is a
+		// conflict: edits to the losing file would silently have no
+		// effect. Across directories the same ID is a deliberate
+		// override.
+		paths := make(map[string]string)
+		for _, entry := range entries {
+			if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".toml") {
+				continue
+			}
+			info, err := entry.Info()
+			if err != nil {
+				return nil, fmt.Errorf("%w: could not stat %s: %w", ErrIO, entry.Name(), err)
+			}
+			c, err := loadCollector(filepath.Join(dir, entry.Name()), info)
+			if errors.Is(err, errMissingID) {
+				// A definition without meta.id is a shared base that
+				// others extend, not a collector of its own.
+				slog.Debug("skipping base definition", "path", entry.Name())
+				continue
+			}
+			if errors.Is(err, ErrConfig) {
+				// One malformed definition should not take down every
+				// other collector; I/O errors, which may be transient,
+				// still abort the scan.
+				slog.Warn("skipping malformed collector definition",
+					"path", entry.Name(), "error", err)
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			if previous, ok := paths[c.Meta.ID]; ok {
+				if Strict {
+					return nil, fmt.Errorf("%w: duplicate collector id %q: %s and %s",
+						ErrConfig, c.Meta.ID, previous, c.Generated.Path)
+				}
+				slog.Warn("duplicate collector id, ignoring later definition",
+					"id", c.Meta.ID, "used", previous, "ignored", c.Generated.Path)
+				continue
+			}
+			paths[c.Meta.ID] = c.Generated.Path
+			byID[c.Meta.ID] = c
+		}
+	}
+
+	// Generated definitions fill in after the static files; a static
+	// file always wins over a generator claiming the same ID.
+	generated, err := generatedCollectors()
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range generated {
+		if previous, ok := byID[c.Meta.ID]; ok {
+			slog.Debug("static definition overrides generated collector",
+				"id", c.Meta.ID, "used", previous.Generated.Path, "ignored", c.Generated.Path)
+			continue
+		}
+		byID[c.Meta.ID] = c
+	}
+
+	collectors := make([]Collector, 0, len(byID))
+	for _, c := range byID {
+		collectors = append(collectors, c)
+	}
+	sort.Slice(collectors, func(i, j int) bool {
+		return collectors[i].Meta.ID < collectors[j].Meta.ID
+	})
+	return collectors, nil
+}
+
+// ValidateCollector parses and validates the definition at path. It
+// returns nil when the file would load as a collector.
+func ValidateCollector(path string) error {
+	_, err := newCollectorFromPath(path)
+	return err
+}
+
+// MatchCollectors returns the collectors whose ID matches the glob
+// pattern. The pattern is resolved against the loaded definitions,
+// not the filesystem, so directory overrides apply. It is an error
+// when nothing matches.
+func MatchCollectors(pattern string) ([]Collector, error) {
+	collectors, err := GetCollectors()
+	if err != nil {
+		return nil, err
+	}
+	var matched []Collector
+	for _, c := range collectors {
+		ok, err := path.Match(pattern, c.Meta.ID)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid collector pattern %q", ErrConfig, pattern)
+		}
+		if ok {
+			matched = append(matched, c)
+		}
+	}
+	if len(matched) == 0 {
+		return nil, fmt.Errorf("%w: no collector matches %q", ErrCollectorNotFound, pattern)
+	}
+	return matched, nil
+}
+
+// GetCollector returns the collector with the given ID. The
+// not-found error names the defined IDs, so a typo is obvious from
+// the message alone.
+func GetCollector(id string) (Collector, error) {
+	collectors, err := GetCollectors()
+	if err != nil {
+		return Collector{}, err
+	}
+	ids := make([]string, 0, len(collectors))
+	for _, c := range collectors {
+		if c.Meta.ID == id {
+			return c, nil
+		}
+		ids = append(ids, c.Meta.ID)
+	}
+	if len(ids) == 0 {
+		return Collector{}, fmt.Errorf("%w: %s (no collectors are defined)",
+			ErrCollectorNotFound, id)
+	}
+	return Collector{}, fmt.Errorf("%w: %s (available: %s)",
+		ErrCollectorNotFound, id, strings.Join(ids, ", "))
+}
@@ -0,0 +1,408 @@
+package insights
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeCollector writes a collector definition into dir and returns
+// its path.
+func writeCollector(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestNewCollectorFromPath(t *testing.T) {
+	dir := t.TempDir()
+	path := writeCollector(t, dir, "os-release.toml", `
+[meta]
+id = "os-release"
+feature = "content"
+
+[meta.labels]
+team = "sos"
+criticality = "low"
+
+[exec]
+command = ["/usr/bin/cat", "/etc/os-release"]
+uid = 982
+gid = 982
+
+[upload]
+content-type = "application/vnd.redhat.advisor.collection+tgz"
+`)
+
+	c, err := newCollectorFromPath(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Meta.ID != "os-release" {
+		t.Errorf("unexpected ID: %q", c.Meta.ID)
+	}
+	if c.Meta.Feature != "content" {
+		t.Errorf("unexpected feature: %q", c.Meta.Feature)
+	}
+	if c.Meta.Labels["team"] != "sos" || c.Meta.Labels["criticality"] != "low" {
+		t.Errorf("unexpected labels: %v", c.Meta.Labels)
+	}
+	if len(c.Exec.Command) != 2 || c.Exec.Command[0] != "/usr/bin/cat" {
+		t.Errorf("unexpected command: %v", c.Exec.Command)
+	}
+	if c.Exec.UID.ID != 982 || c.Exec.GID.ID != 982 {
+		t.Errorf("unexpected uid/gid: %s/%s", c.Exec.UID, c.Exec.GID)
+	}
+	if c.Upload.ContentType != "application/vnd.redhat.advisor.collection+tgz" {
+		t.Errorf("unexpected content type: %q", c.Upload.ContentType)
+	}
+	if !c.Meta.Enabled {
+		t.Error("collectors should be enabled by default")
+	}
+}
+
+func TestNewCollectorFromPathDisabled(t *testing.T) {
+	dir := t.TempDir()
+	path := writeCollector(t, dir, "disabled.toml", `
+[meta]
+id = "disabled"
+enabled = false
+
+[exec]
+command = ["/bin/true"]
+`)
+
+	c, err := newCollectorFromPath(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Meta.Enabled {
+		t.Error("expected the collector to be disabled")
+	}
+}
+
+func TestNewCollectorFromPathNamedIDs(t *testing.T) {
+	dir := t.TempDir()
+	path := writeCollector(t, dir, "named.toml", `
+[meta]
+id = "named"
+
+[exec]
+command = ["/bin/true"]
+uid = "root"
+gid = "root"
+`)
+
+	c, err := newCollectorFromPath(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Exec.UID.Name != "root" || c.Exec.UID.ID != 0 {
+		t.Errorf("unexpected uid: %s", c.Exec.UID)
+	}
+	if c.Exec.GID.Name != "root" || c.Exec.GID.ID != 0 {
+		t.Errorf("unexpected gid: %s", c.Exec.GID)
+	}
+
+	path = writeCollector(t, dir, "unknown.toml", `
+[meta]
+id = "unknown"
+
+[exec]
+command = ["/bin/true"]
+uid = "no-such-user-rhc"
+`)
+	if _, err := newCollectorFromPath(path); !errors.Is(err, ErrConfig) {
+		t.Errorf("expected ErrConfig for an unknown user, got %v", err)
+	}
+}
+
+func TestNewCollectorFromPathInvalid(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"missing-id.toml", "[exec]\ncommand = [\"/bin/true\"]\n"},
+		{"missing-command.toml", "[meta]\nid = \"x\"\n"},
+		{"bad-env.toml", "[meta]\nid = \"x\"\n[exec]\ncommand = [\"/bin/true\"]\n[exec.env]\n\"BAD NAME\" = \"y\"\n"},
+	}
+	for _, test := range tests {
+		path := writeCollector(t, dir, test.name, test.content)
+		if _, err := newCollectorFromPath(path); err == nil {
+			t.Errorf("%s: expected an error", test.name)
+		}
+	}
+}
+
+func TestNewCollectorFromPathFilenameMismatch(t *testing.T) {
+	dir := t.TempDir()
+	path := writeCollector(t, dir, "foo.toml", `
+[meta]
+id = "bar"
+[exec]
+command = ["/bin/true"]
+`)
+
+	// A mismatch is only a warning by default.
+	if _, err := newCollectorFromPath(path); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	Strict = true
+	defer func() { Strict = false }()
+	if _, err := newCollectorFromPath(path); !errors.Is(err, ErrConfig) {
+		t.Errorf("expected ErrConfig under Strict, got %v", err)
+	}
+}
+
+func TestCollectorCache(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("CONFIG_DIR", dir)
+	path := writeCollector(t, dir, "cached.toml",
+		"[meta]\nid = \"cached\"\nfeature = \"one\"\n[exec]\ncommand = [\"/bin/true\"]\n")
+
+	c, err := GetCollector("cached")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Meta.Feature != "one" {
+		t.Fatalf("unexpected feature: %q", c.Meta.Feature)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Same size and mtime: the cached parse must be reused.
+	writeCollector(t, dir, "cached.toml",
+		"[meta]\nid = \"cached\"\nfeature = \"two\"\n[exec]\ncommand = [\"/bin/true\"]\n")
+	if err := os.Chtimes(path, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	c, err = GetCollector("cached")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Meta.Feature != "one" {
+		t.Errorf("expected the cached definition, got feature %q", c.Meta.Feature)
+	}
+
+	// A changed mtime invalidates the entry.
+	future := info.ModTime().Add(2 * time.Second)
+	if err := os.Chtimes(path, future, future); err != nil {
+		t.Fatal(err)
+	}
+	c, err = GetCollector("cached")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Meta.Feature != "two" {
+		t.Errorf("expected the updated definition, got feature %q", c.Meta.Feature)
+	}
+}
+
+func TestGetCollectorsDropInOverride(t *testing.T) {
+	vendor := t.TempDir()
+	admin := t.TempDir()
+	t.Setenv("CONFIG_DIR", vendor+string(os.PathListSeparator)+admin)
+
+	writeCollector(t, vendor, "shared.toml",
+		"[meta]\nid = \"shared\"\nfeature = \"vendor\"\n[exec]\ncommand = [\"/bin/true\"]\n")
+	writeCollector(t, vendor, "vendor-only.toml",
+		"[meta]\nid = \"vendor-only\"\n[exec]\ncommand = [\"/bin/true\"]\n")
+	writeCollector(t, admin, "override.toml",
+		"[meta]\nid = \"shared\"\nfeature = \"admin\"\n[exec]\ncommand = [\"/bin/true\"]\n")
+
+	collectors, err := GetCollectors()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(collectors) != 2 {
+		t.Fatalf("expected 2 collectors, got %d", len(collectors))
+	}
+
+	c, err := GetCollector("shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Meta.Feature != "admin" {
+		t.Errorf("expected the admin drop-in to win, got feature %q", c.Meta.Feature)
+	}
+}
+
+func TestGetCollectorsSkipsMalformed(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("CONFIG_DIR", dir)
+	writeCollector(t, dir, "good.toml",
+		"[meta]\nid = \"good\"\n[exec]\ncommand = [\"/bin/true\"]\n")
+	writeCollector(t, dir, "broken.toml", "[meta]\nid = \"broken\"\n")
+
+	collectors, err := GetCollectors()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(collectors) != 1 || collectors[0].Meta.ID != "good" {
+		t.Errorf("expected only the well-formed collector, got %v", collectors)
+	}
+}
+
+func TestGetCollectorsDuplicateID(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("CONFIG_DIR", dir)
+	writeCollector(t, dir, "first.toml",
+		"[meta]\nid = \"dup\"\nfeature = \"first\"\n[exec]\ncommand = [\"/bin/true\"]\n")
+	writeCollector(t, dir, "second.toml",
+		"[meta]\nid = \"dup\"\nfeature = \"second\"\n[exec]\ncommand = [\"/bin/true\"]\n")
+
+	// The first definition (in directory order) wins; the duplicate
+	// is ignored with a warning.
+	collectors, err := GetCollectors()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(collectors) != 1 || collectors[0].Meta.Feature != "first" {
+		t.Errorf("expected the first definition to win, got %v", collectors)
+	}
+
+	Strict = true
+	defer func() { Strict = false }()
+	if _, err := GetCollectors(); !errors.Is(err, ErrConfig) {
+		t.Errorf("expected ErrConfig under Strict, got %v", err)
+	}
+}
+
+func TestGetCollector(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("CONFIG_DIR", dir)
+	writeCollector(t, dir, "a.toml",
+		"[meta]\nid = \"a\"\n[exec]\ncommand = [\"/bin/true\"]\n")
+	writeCollector(t, dir, "b.toml",
+		"[meta]\nid = \"b\"\n[exec]\ncommand = [\"/bin/true\"]\n")
+
+	c, err := GetCollector("b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Meta.ID != "b" {
+		t.Errorf("unexpected collector: %q", c.Meta.ID)
+	}
+
+	if _, err := GetCollector("missing"); !errors.Is(err, ErrCollectorNotFound) {
+		t.Errorf("expected ErrCollectorNotFound, got %v", err)
+	}
+}
+
+func TestMatchCollectors(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("CONFIG_DIR", dir)
+	writeCollector(t, dir, "advisor-a.toml",
+		"[meta]\nid = \"advisor-a\"\n[exec]\ncommand = [\"/bin/true\"]\n")
+	writeCollector(t, dir, "advisor-b.toml",
+		"[meta]\nid = \"advisor-b\"\n[exec]\ncommand = [\"/bin/true\"]\n")
+	writeCollector(t, dir, "other.toml",
+		"[meta]\nid = \"other\"\n[exec]\ncommand = [\"/bin/true\"]\n")
+
+	matched, err := MatchCollectors("advisor-*")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(matched) != 2 {
+		t.Fatalf("expected 2 matches, got %d", len(matched))
+	}
+	for _, c := range matched {
+		if c.Meta.ID == "other" {
+			t.Errorf("matched the wrong collector: %s", c.Meta.ID)
+		}
+	}
+
+	if _, err := MatchCollectors("nomatch-*"); !errors.Is(err, ErrCollectorNotFound) {
+		t.Errorf("expected ErrCollectorNotFound, got %v", err)
+	}
+}
+
+func TestNewCollectorFromPathExtends(t *testing.T) {
+	dir := t.TempDir()
+	writeCollector(t, dir, "base.toml", `
+[exec]
+uid = 982
+gid = 982
+
+[upload]
+content-type = "application/vnd.redhat.advisor.collection+tgz"
+`)
+	path := writeCollector(t, dir, "child.toml", `
+extends = "base.toml"
+
+[meta]
+id = "child"
+
+[exec]
+command = ["/bin/true"]
+uid = 123
+`)
+
+	c, err := newCollectorFromPath(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Exec.UID.ID != 123 {
+		t.Errorf("expected the child uid to win, got %s", c.Exec.UID)
+	}
+	if c.Exec.GID.ID != 982 {
+		t.Errorf("expected the base gid to be inherited, got %s", c.Exec.GID)
+	}
+	if c.Upload.ContentType != "application/vnd.redhat.advisor.collection+tgz" {
+		t.Errorf("expected the base content type to be inherited, got %q", c.Upload.ContentType)
+	}
+
+	// The base has no meta.id and must not show up as a collector.
+	t.Setenv("CONFIG_DIR", dir)
+	collectors, err := GetCollectors()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(collectors) != 1 || collectors[0].Meta.ID != "child" {
+		t.Errorf("expected only the child collector, got %v", collectors)
+	}
+}
+
+func TestNewCollectorFromPathExtendsErrors(t *testing.T) {
+	dir := t.TempDir()
+	missing := writeCollector(t, dir, "missing.toml", `
+extends = "no-such-base.toml"
+
+[meta]
+id = "missing"
+
+[exec]
+command = ["/bin/true"]
+`)
+	if _, err := newCollectorFromPath(missing); !errors.Is(err, ErrConfig) {
+		t.Errorf("expected ErrConfig for a missing base, got %v", err)
+	}
+
+	writeCollector(t, dir, "a.toml", "extends = \"b.toml\"\n")
+	cycle := writeCollector(t, dir, "b.toml", "extends = \"a.toml\"\n")
+	if _, err := newCollectorFromPath(cycle); !errors.Is(err, ErrConfig) {
+		t.Errorf("expected ErrConfig for an include cycle, got %v", err)
+	}
+}
+
+func TestUploadURLMustBeHTTPS(t *testing.T) {
+	c := Collector{Exec: ExecOptions{Command: []string{"/bin/true"}}}
+	c.Upload.URL = "http://insecure.example.com/upload"
+	if err := finishCollector(&c, "insecure.toml"); !errors.Is(err, ErrConfig) {
+		t.Errorf("expected ErrConfig for a non-https upload URL, got %v", err)
+	}
+	c.Upload.URL = "https://edge.example.com/upload"
+	if err := finishCollector(&c, "edge.toml"); err != nil {
+		t.Errorf("https upload URL rejected: %v", err)
+	}
+}
@@ -0,0 +1,301 @@
+package insights
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Compress packs the given collection directory into a gzipped tar
+// archive next to it. It returns the path to the archive and a
+// manifest of the files it contains, so callers can show or record
+// what is about to be uploaded. Each added file is also logged at
+// info level. Compression stops between files when ctx expires.
+//
+// level selects the gzip compression level, 1 (fastest) to 9
+// (smallest); zero picks gzip's default. Busy hosts can trade size
+// for CPU with a low level, bandwidth-constrained ones the reverse.
+//
+// With reproducible set, the archive is byte-for-byte identical for
+// identical directory contents: file metadata that varies between
+// runs (timestamps, ownership) is normalized away. File timestamps
+// are taken from SOURCE_DATE_EPOCH when set, the Unix epoch
+// otherwise.
+func Compress(ctx context.Context, directory string, level int, reproducible bool) (string, []string, error) {
+	return compressInto(ctx, directory, directory+".tar.gz", level, reproducible)
+}
+
+// compressInto packs the collection directory into an archive at the
+// given path. The path may lie inside the directory itself — tmpfs
+// collections keep their archive in the mount so compressed data
+// stays off persistent disk — in which case the in-progress archive
+// is excluded from the walk.
+func compressInto(ctx context.Context, directory, archive string, level int, reproducible bool) (string, []string, error) {
+	f, err := os.Create(archive)
+	if err != nil {
+		return "", nil, fmt.Errorf("could not create archive: %w", err)
+	}
+	defer f.Close()
+
+	manifest, err := packArchive(ctx, directory, archive, f, level, reproducible)
+	if err != nil {
+		return "", nil, err
+	}
+	return archive, manifest, nil
+}
+
+// CompressStream packs the collection directory like Compress, but
+// returns a reader producing the gzipped tar, so the compressed
+// bytes can go straight to an upload without ever landing on disk.
+// The archive is written from a goroutine; closing the reader aborts
+// it.
+func CompressStream(ctx context.Context, directory string, level int, reproducible bool) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		_, err := packArchive(ctx, directory, "", pw, level, reproducible)
+		pw.CloseWithError(err)
+	}()
+	return pr
+}
+
+// packArchive writes the directory as a gzipped tar to w and
+// returns the manifest of packed files. skip names the archive's own
+// path when it lives inside the directory, so it does not pack
+// itself.
+func packArchive(ctx context.Context, directory, skip string, w io.Writer, level int, reproducible bool) ([]string, error) {
+	if level == 0 {
+		level = gzip.DefaultCompression
+	}
+	if level < gzip.DefaultCompression || level > gzip.BestCompression {
+		return nil, fmt.Errorf("%w: invalid compression level %d (valid: 1-9)",
+			ErrConfig, level)
+	}
+
+	var manifest []string
+
+	gw, err := gzip.NewWriterLevel(w, level)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid compression level %d: %w", ErrConfig, level, err)
+	}
+	tw := tar.NewWriter(gw)
+
+	// WalkDir visits entries in lexical order, so the file ordering is
+	// already stable.
+	err = filepath.WalkDir(directory, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if skip != "" && path == skip {
+			return nil
+		}
+		rel, err := filepath.Rel(directory, path)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		// A collector (malicious or buggy) could plant symlinks
+		// pointing outside the collection directory; following them
+		// would leak host files into the upload. WalkDir already does
+		// not descend into symlinked directories, and symlinked files
+		// are skipped here rather than resolved.
+		if d.Type()&fs.ModeSymlink != 0 {
+			slog.Warn("skipping symlink in collection", "path", rel)
+			return nil
+		}
+		if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("%s escapes the collection directory", path)
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() && !info.IsDir() {
+			return nil
+		}
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = rel
+		if info.IsDir() {
+			header.Name += "/"
+		}
+		if reproducible {
+			normalizeHeader(header)
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		slog.Info("adding file to archive", "path", rel, "size", info.Size())
+		manifest = append(manifest, rel)
+		src, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+		_, err = io.Copy(tw, src)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not compress %s: %w", directory, err)
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, fmt.Errorf("could not finalize archive: %w", err)
+	}
+	if err := gw.Close(); err != nil {
+		return nil, fmt.Errorf("could not finalize archive: %w", err)
+	}
+	return manifest, nil
+}
+
+// normalizeHeader strips the tar header fields that vary between
+// otherwise identical collections, so reproducible archives compare
+// equal byte for byte. The gzip layer needs no such treatment: Go
+// never embeds a hostname or timestamp unless asked to.
+func normalizeHeader(header *tar.Header) {
+	header.ModTime = sourceDateEpoch()
+	header.AccessTime = time.Time{}
+	header.ChangeTime = time.Time{}
+	header.Uid = 0
+	header.Gid = 0
+	header.Uname = ""
+	header.Gname = ""
+	header.Format = tar.FormatPAX
+}
+
+// sourceDateEpoch returns the timestamp reproducible archives stamp
+// on their files: SOURCE_DATE_EPOCH (seconds since the Unix epoch, a
+// convention shared with other reproducible-build tooling) when set,
+// the epoch itself otherwise.
+func sourceDateEpoch() time.Time {
+	if value := os.Getenv("SOURCE_DATE_EPOCH"); value != "" {
+		if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return time.Unix(seconds, 0).UTC()
+		}
+		slog.Warn("ignoring invalid SOURCE_DATE_EPOCH", "value", value)
+	}
+	return time.Unix(0, 0).UTC()
+}
+
+// ManifestEntry describes one collected file in the manifest packed
+// into the archive.
+type ManifestEntry struct {
+	// Path is the file's path relative to the collection directory.
+	Path string `json:"path"`
+	// Size is the file size in bytes.
+	Size int64 `json:"size"`
+	// SHA256 is the hex-encoded digest of the file's contents.
+	SHA256 string `json:"sha256"`
+}
+
+// manifestName is the file the manifest is written to inside the
+// collection directory, and thus inside the archive.
+const manifestName = "manifest.json"
+
+// WriteManifest writes a manifest.json into the collection directory
+// listing every collected file with its relative path, size and
+// SHA-256 digest, and returns the entries. The manifest travels
+// inside the archive, so the upload records precisely what it
+// contains; a pre-existing manifest.json is replaced.
+func WriteManifest(directory string) ([]ManifestEntry, error) {
+	var entries []ManifestEntry
+	err := filepath.WalkDir(directory, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(directory, path)
+		if err != nil {
+			return err
+		}
+		if rel == manifestName {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		digest, err := fileChecksum(path)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, ManifestEntry{Path: rel, Size: info.Size(), SHA256: digest})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not build manifest for %s: %w", directory, err)
+	}
+
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("could not encode manifest: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(directory, manifestName), append(data, '\n'), 0o600); err != nil {
+		return nil, fmt.Errorf("could not write manifest: %w", err)
+	}
+	return entries, nil
+}
+
+// ContentHash returns a hex-encoded SHA-256 digest over the files in
+// the collection directory: their paths and contents, in a stable
+// order. Unlike a digest of the archive it does not vary with file
+// timestamps, so two collections of identical data hash the same.
+func ContentHash(directory string) (string, error) {
+	var files []string
+	err := filepath.WalkDir(directory, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("could not hash %s: %w", directory, err)
+	}
+	sort.Strings(files)
+
+	digest := sha256.New()
+	for _, path := range files {
+		rel, err := filepath.Rel(directory, path)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(digest, "%s\x00", rel)
+		f, err := os.Open(path)
+		if err != nil {
+			return "", fmt.Errorf("could not hash %s: %w", path, err)
+		}
+		_, err = io.Copy(digest, f)
+		f.Close()
+		if err != nil {
+			return "", fmt.Errorf("could not hash %s: %w", path, err)
+		}
+	}
+	return hex.EncodeToString(digest.Sum(nil)), nil
+}
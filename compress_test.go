@@ -0,0 +1,87 @@
+package insights
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCompressSkipsSymlinks(t *testing.T) {
+	directory := filepath.Join(t.TempDir(), "example-1")
+	if err := os.MkdirAll(directory, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(directory, "data.txt"), []byte("data"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	secret := filepath.Join(t.TempDir(), "secret.txt")
+	if err := os.WriteFile(secret, []byte("host secret"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(secret, filepath.Join(directory, "escape.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	archive, manifest, err := Compress(context.Background(), directory, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range manifest {
+		if name == "escape.txt" {
+			t.Error("symlink was packed into the archive")
+		}
+	}
+
+	// The archive itself must not contain the link target's data.
+	f, err := os.Open(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gr)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if header.Name == "escape.txt" {
+			t.Error("symlink entry found in the archive")
+		}
+	}
+}
+
+func TestCompressIntoDirectory(t *testing.T) {
+	directory := filepath.Join(t.TempDir(), "example-1")
+	if err := os.MkdirAll(directory, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(directory, "data.txt"), []byte("data"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// An archive placed inside the directory, as tmpfs collections do,
+	// must not pack itself.
+	archive, manifest, err := compressInto(context.Background(), directory,
+		filepath.Join(directory, "example-1.tar.gz"), 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest) != 1 || manifest[0] != "data.txt" {
+		t.Errorf("unexpected manifest: %v", manifest)
+	}
+	if _, err := os.Stat(archive); err != nil {
+		t.Errorf("archive missing from the collection directory: %v", err)
+	}
+}
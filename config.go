@@ -0,0 +1,110 @@
+package insights
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+
+	"github.com/BurntSushi/toml"
+)
+
+// DefaultConfigPath is where global settings are read from unless a
+// different path is given.
+const DefaultConfigPath = "/etc/rhc/rhc.conf"
+
+// Config holds global settings that can be provided through the
+// configuration file. Environment variables and command line flags
+// take precedence over values from the file; unset values fall back
+// to built-in defaults.
+type Config struct {
+	// ConfigDir is the directory holding collector definitions.
+	ConfigDir string `toml:"config-dir"`
+	// CacheDir is the directory holding collector state.
+	CacheDir string `toml:"cache-dir"`
+	// CollectionsDir is the directory collectors write into.
+	CollectionsDir string `toml:"collections-dir"`
+	// GeneratorsDir is the directory holding collector generators:
+	// executables emitting definitions as TOML on standard output.
+	GeneratorsDir string `toml:"generators-dir"`
+	// IngressURL is the upload endpoint.
+	IngressURL string `toml:"ingress-url"`
+	// Proxy is the proxy URL used for uploads.
+	Proxy string `toml:"proxy"`
+	// CertFile and KeyFile point at the client certificate used to
+	// authenticate against Ingress.
+	CertFile string `toml:"cert-file"`
+	KeyFile  string `toml:"key-file"`
+	// CAFile points at an extra CA bundle trusted for uploads, for
+	// on-premise Ingress endpoints with a private CA.
+	CAFile string `toml:"ca-file"`
+	// Username and Password switch uploads to HTTP basic
+	// authentication, for deployments such as Satellite that do not
+	// issue consumer certificates. Mutually exclusive with Token.
+	Username string `toml:"username"`
+	Password string `toml:"password"`
+	// Token switches uploads to bearer-token authentication.
+	Token string `toml:"token"`
+	// TLSMinVersion is the minimum TLS version accepted for uploads
+	// ("1.2" or "1.3"). Defaults to 1.2.
+	TLSMinVersion string `toml:"tls-min-version"`
+	// MaxIdleConns and IdleConnTimeout tune the upload connection
+	// pool for fleets pushing large archives; zero values keep the
+	// built-in defaults (10 connections, 90s).
+	MaxIdleConns    int    `toml:"max-idle-conns"`
+	IdleConnTimeout string `toml:"idle-conn-timeout"`
+	// LogLevel is the minimum log level ("debug", "warn", ...).
+	LogLevel string `toml:"log-level"`
+	// AuditLog is the file upload audit records are appended to;
+	// empty disables audit logging. The AUDIT_LOG environment
+	// variable and the run command's --audit-log flag take
+	// precedence.
+	AuditLog string `toml:"audit-log"`
+	// ContentTypes extends the registry of recognized upload content
+	// types, for payloads of services this client does not know about
+	// yet.
+	ContentTypes []string `toml:"content-types"`
+	// Systemd holds scheduling settings applied when timers are
+	// enabled.
+	Systemd SystemdConfig `toml:"systemd"`
+}
+
+// SystemdConfig holds the [systemd] section of the configuration
+// file.
+type SystemdConfig struct {
+	// RandomizedDelay spreads timer activations by a random delay of
+	// up to this duration (systemd's RandomizedDelaySec, e.g. "10m"),
+	// so fleets do not hit Ingress at the exact same minute. The
+	// enable command's --randomized-delay flag takes precedence.
+	RandomizedDelay string `toml:"randomized-delay"`
+	// Unit is the name of the template unit collectors are scheduled
+	// with, with or without the trailing @ (e.g. "rhc-collector" or
+	// "insights-task@"). One template serves every collector; the
+	// instance is the collector ID. Defaults to rhc-collector.
+	Unit string `toml:"unit"`
+}
+
+// currentConfig holds the settings loaded by LoadConfig. The zero
+// value means everything falls back to environment variables and
+// built-in defaults.
+var currentConfig Config
+
+// CurrentConfig returns the settings loaded by LoadConfig.
+func CurrentConfig() Config {
+	return currentConfig
+}
+
+// LoadConfig reads global settings from the TOML file at path. A
+// missing file at the default path is not an error; the defaults
+// simply stay in effect.
+func LoadConfig(path string) error {
+	var c Config
+	if _, err := toml.DecodeFile(path, &c); err != nil {
+		if errors.Is(err, fs.ErrNotExist) && path == DefaultConfigPath {
+			return nil
+		}
+		return fmt.Errorf("%w: could not read %s: %w", ErrConfig, path, err)
+	}
+	currentConfig = c
+	resetIngressTransport()
+	return nil
+}
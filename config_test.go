@@ -0,0 +1,54 @@
+package insights
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadConfig(t *testing.T) {
+	t.Cleanup(func() { currentConfig = Config{} })
+
+	path := filepath.Join(t.TempDir(), "rhc.conf")
+	content := `
+config-dir = "/tmp/collectors.d"
+ingress-url = "https://ingress.example.com/upload"
+log-level = "debug"
+`
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadConfig(path); err != nil {
+		t.Fatal(err)
+	}
+
+	if ConfigDir() != "/tmp/collectors.d" {
+		t.Errorf("unexpected config dir: %q", ConfigDir())
+	}
+	if IngressURL() != "https://ingress.example.com/upload" {
+		t.Errorf("unexpected ingress URL: %q", IngressURL())
+	}
+	if CurrentConfig().LogLevel != "debug" {
+		t.Errorf("unexpected log level: %q", CurrentConfig().LogLevel)
+	}
+
+	// Environment variables take precedence over the file.
+	t.Setenv("CONFIG_DIR", "/tmp/other.d")
+	if ConfigDir() != "/tmp/other.d" {
+		t.Errorf("environment should override the file, got %q", ConfigDir())
+	}
+}
+
+func TestLoadConfigMissing(t *testing.T) {
+	t.Cleanup(func() { currentConfig = Config{} })
+
+	// A missing file at the default path keeps the defaults.
+	if err := LoadConfig(DefaultConfigPath); err != nil {
+		t.Errorf("missing default config should not fail: %v", err)
+	}
+
+	// A missing file given explicitly is an error.
+	if err := LoadConfig(filepath.Join(t.TempDir(), "nope.conf")); err == nil {
+		t.Error("expected an error for an explicit missing file")
+	}
+}
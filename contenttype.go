@@ -0,0 +1,58 @@
+package insights
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+)
+
+// builtinContentTypes lists the Ingress payload types this client
+// knows services to be listening for. The set is not authoritative —
+// Ingress routes whatever it recognizes server-side — but checking
+// definitions against it catches the typos that otherwise surface as
+// silently discarded uploads.
+var builtinContentTypes = []string{
+	"application/vnd.redhat.advisor.collection+tgz",
+	"application/vnd.redhat.compliance.upload+tgz",
+	"application/vnd.redhat.malware-detection.results+tgz",
+	"application/vnd.redhat.tasks.payload+tgz",
+}
+
+// KnownContentTypes returns the recognized upload content types: the
+// built-in set plus any added through the content-types configuration
+// key, sorted and deduplicated.
+func KnownContentTypes() []string {
+	seen := make(map[string]bool)
+	var types []string
+	for _, t := range append(builtinContentTypes, currentConfig.ContentTypes...) {
+		if seen[t] {
+			continue
+		}
+		seen[t] = true
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// checkContentType warns when a collector declares a content type the
+// registry does not know, which is almost always a typo; under Strict
+// the definition is rejected instead. origin names the definition in
+// the message.
+func checkContentType(c Collector, origin string) error {
+	if c.Upload.ContentType == "" {
+		return nil
+	}
+	for _, t := range KnownContentTypes() {
+		if t == c.Upload.ContentType {
+			return nil
+		}
+	}
+	if Strict {
+		return fmt.Errorf("%w: %s: unknown upload content type %q (known types: rhc collector content-types)",
+			ErrConfig, origin, c.Upload.ContentType)
+	}
+	slog.Warn("unknown upload content type, check for a typo",
+		"origin", origin, "content-type", c.Upload.ContentType)
+	return nil
+}
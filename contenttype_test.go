@@ -0,0 +1,49 @@
+package insights
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestKnownContentTypes(t *testing.T) {
+	t.Cleanup(func() { currentConfig = Config{} })
+	currentConfig.ContentTypes = []string{
+		"application/vnd.redhat.example.payload+tgz",
+		// Duplicating a built-in must not list it twice.
+		"application/vnd.redhat.tasks.payload+tgz",
+	}
+
+	types := KnownContentTypes()
+	if len(types) != len(builtinContentTypes)+1 {
+		t.Fatalf("unexpected registry: %v", types)
+	}
+	found := false
+	for _, ct := range types {
+		if ct == "application/vnd.redhat.example.payload+tgz" {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("configured content type is missing from the registry")
+	}
+}
+
+func TestCheckContentType(t *testing.T) {
+	known := Collector{}
+	known.Upload.ContentType = "application/vnd.redhat.advisor.collection+tgz"
+	if err := checkContentType(known, "known.toml"); err != nil {
+		t.Errorf("known content type rejected: %v", err)
+	}
+
+	typo := Collector{}
+	typo.Upload.ContentType = "application/vnd.redhat.advisor.colection+tgz"
+	if err := checkContentType(typo, "typo.toml"); err != nil {
+		t.Errorf("unknown content type must only warn: %v", err)
+	}
+
+	Strict = true
+	t.Cleanup(func() { Strict = false })
+	if err := checkContentType(typo, "typo.toml"); !errors.Is(err, ErrConfig) {
+		t.Errorf("unknown content type must fail under strict mode, got %v", err)
+	}
+}
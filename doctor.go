@@ -0,0 +1,189 @@
+package insights
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// CheckStatus classifies the outcome of one doctor check.
+type CheckStatus string
+
+const (
+	// CheckPass means the check found nothing wrong.
+	CheckPass CheckStatus = "pass"
+	// CheckWarn means something is off but collection can still work.
+	CheckWarn CheckStatus = "warn"
+	// CheckFail means the check found a problem that will break
+	// collection or upload.
+	CheckFail CheckStatus = "fail"
+)
+
+// Check is the outcome of one environment check performed by Doctor.
+type Check struct {
+	Name   string      `json:"name"`
+	Status CheckStatus `json:"status"`
+	Detail string      `json:"detail"`
+}
+
+// Doctor inspects the host for the usual reasons collection or upload
+// fails — unreadable certificates, an unreachable Ingress endpoint, a
+// bad proxy, unwritable state directories, missing systemd — and
+// returns one Check per finding. It is meant for support engineers to
+// run before digging through logs.
+func Doctor(ctx context.Context) []Check {
+	return []Check{
+		checkCertificate(),
+		checkIngress(ctx),
+		checkProxy(),
+		checkWritable("config directory", ConfigDir(), CheckWarn),
+		checkWritable("cache directory", CacheDir(), CheckFail),
+		checkWritable("collections directory", CollectionsDir(), CheckFail),
+		checkSystemd(),
+		checkCollectors(),
+	}
+}
+
+// checkCertificate verifies the client certificate Upload
+// authenticates with is readable. A missing certificate is only a
+// warning: uploads are attempted without client authentication.
+func checkCertificate() Check {
+	check := Check{Name: "client certificate"}
+	certFile, keyFile := CertPaths()
+	if _, err := os.Stat(certFile); err != nil {
+		check.Status = CheckWarn
+		check.Detail = fmt.Sprintf("%s missing, uploads will not be authenticated", certFile)
+		return check
+	}
+	for _, path := range []string{certFile, keyFile} {
+		f, err := os.Open(path)
+		if err != nil {
+			check.Status = CheckFail
+			check.Detail = err.Error()
+			return check
+		}
+		f.Close()
+	}
+	check.Status = CheckPass
+	check.Detail = certFile
+	return check
+}
+
+// checkIngress verifies the Ingress endpoint answers at all. Any HTTP
+// response counts: the endpoint rejecting an empty HEAD request still
+// proves the host is resolvable and reachable through the configured
+// transport.
+func checkIngress(ctx context.Context) Check {
+	check := Check{Name: "ingress endpoint"}
+	client, err := newIngressClient(10 * time.Second)
+	if err != nil {
+		check.Status = CheckFail
+		check.Detail = err.Error()
+		return check
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, IngressURL(), nil)
+	if err != nil {
+		check.Status = CheckFail
+		check.Detail = err.Error()
+		return check
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		check.Status = CheckFail
+		check.Detail = err.Error()
+		return check
+	}
+	resp.Body.Close()
+	check.Status = CheckPass
+	check.Detail = fmt.Sprintf("%s answered %s", IngressURL(), resp.Status)
+	return check
+}
+
+// checkProxy verifies a configured upload proxy parses and its host
+// resolves. Without a configured proxy there is nothing to check.
+func checkProxy() Check {
+	check := Check{Name: "proxy"}
+	if currentConfig.Proxy == "" {
+		check.Status = CheckPass
+		check.Detail = "not configured"
+		return check
+	}
+	proxyURL, err := url.Parse(currentConfig.Proxy)
+	if err != nil {
+		check.Status = CheckFail
+		check.Detail = err.Error()
+		return check
+	}
+	if _, err := net.LookupHost(proxyURL.Hostname()); err != nil {
+		check.Status = CheckFail
+		check.Detail = err.Error()
+		return check
+	}
+	check.Status = CheckPass
+	check.Detail = proxyURL.Redacted()
+	return check
+}
+
+// checkWritable verifies files can be created in the directory,
+// creating it first if needed. onError tells how bad an unwritable
+// directory is: the admin config directory is only a warning for
+// unprivileged users, the state directories are not.
+func checkWritable(name, dir string, onError CheckStatus) Check {
+	check := Check{Name: name}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		check.Status = onError
+		check.Detail = err.Error()
+		return check
+	}
+	f, err := os.CreateTemp(dir, ".doctor-*")
+	if err != nil {
+		check.Status = onError
+		check.Detail = err.Error()
+		return check
+	}
+	f.Close()
+	os.Remove(f.Name())
+	check.Status = CheckPass
+	check.Detail = dir + " is writable"
+	return check
+}
+
+// checkSystemd verifies systemctl is available. Without it scheduling
+// is unavailable, but one-shot runs still work, so this is only a
+// warning.
+func checkSystemd() Check {
+	check := Check{Name: "systemd"}
+	path, err := exec.LookPath("systemctl")
+	if err != nil {
+		check.Status = CheckWarn
+		check.Detail = "systemctl not found, enable/disable will not work"
+		return check
+	}
+	check.Status = CheckPass
+	check.Detail = path
+	return check
+}
+
+// checkCollectors verifies at least one collector definition loads.
+func checkCollectors() Check {
+	check := Check{Name: "collectors"}
+	collectors, err := GetCollectors()
+	if err != nil {
+		check.Status = CheckFail
+		check.Detail = err.Error()
+		return check
+	}
+	if len(collectors) == 0 {
+		check.Status = CheckWarn
+		check.Detail = "no collectors are defined"
+		return check
+	}
+	check.Status = CheckPass
+	check.Detail = fmt.Sprintf("%d collector(s) loaded", len(collectors))
+	return check
+}
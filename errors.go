@@ -0,0 +1,32 @@
+package insights
+
+import "errors"
+
+// Sentinel errors used to classify failures. Callers can match them
+// with errors.Is to tell failure categories apart, for example to map
+// them to distinct exit codes.
+var (
+	// ErrCollectorNotFound is returned when no collector with the
+	// requested ID is defined.
+	ErrCollectorNotFound = errors.New("no such collector")
+	// ErrConfig is returned when collector definitions cannot be
+	// parsed or carry invalid values.
+	ErrConfig = errors.New("invalid configuration")
+	// ErrIO is returned when definitions cannot be read from the
+	// filesystem, e.g. during a hiccup of a network mount. Unlike
+	// ErrConfig it marks a potentially transient condition worth
+	// retrying.
+	ErrIO = errors.New("i/o error")
+	// ErrCollect is returned when a collector's command fails.
+	ErrCollect = errors.New("collection failed")
+	// ErrUpload is returned when an archive cannot be delivered to
+	// the Ingress service.
+	ErrUpload = errors.New("upload failed")
+	// ErrBusy is returned when another process is already running the
+	// same collector.
+	ErrBusy = errors.New("collector is already running")
+	// ErrNoSystemd is returned by scheduling operations on hosts
+	// without systemd, such as containers. Collectors can still be
+	// run, listed and inspected there; only timers need systemd.
+	ErrNoSystemd = errors.New("scheduling requires systemd, which is not available on this host")
+)
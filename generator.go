@@ -0,0 +1,99 @@
+package insights
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// generatorTimeout bounds one generator execution. A generator that
+// hangs must not stall every command that lists collectors.
+const generatorTimeout = 10 * time.Second
+
+// generatedCollectors discovers collectors produced by generators:
+// executables under GeneratorsDir that emit one collector definition
+// as TOML on standard output. Generators enable collector sets
+// computed at runtime, for example per subscription entitlement.
+// Static definition files remain the primary source; GetCollectors
+// lets them override generated collectors with the same ID.
+//
+// A failing or malformed generator is skipped with a warning so it
+// cannot take the remaining collectors down, or aborts the scan
+// under Strict.
+func generatedCollectors() ([]Collector, error) {
+	entries, err := os.ReadDir(GeneratorsDir())
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: could not read generators directory: %w", ErrIO, err)
+	}
+
+	var collectors []Collector
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, fmt.Errorf("%w: could not stat %s: %w", ErrIO, entry.Name(), err)
+		}
+		if info.Mode()&0o111 == 0 {
+			continue
+		}
+		path := filepath.Join(GeneratorsDir(), entry.Name())
+		c, err := runGenerator(path)
+		if err != nil {
+			if Strict {
+				return nil, err
+			}
+			slog.Warn("skipping failed collector generator", "path", path, "error", err)
+			continue
+		}
+		collectors = append(collectors, c)
+	}
+	return collectors, nil
+}
+
+// runGenerator executes one generator and parses its output into a
+// collector, validated like a static definition.
+func runGenerator(path string) (Collector, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), generatorTimeout)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, path).Output()
+	if ctx.Err() != nil {
+		return Collector{}, fmt.Errorf("%w: generator %s did not finish within %s",
+			ErrConfig, path, generatorTimeout)
+	}
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			return Collector{}, fmt.Errorf("%w: generator %s failed: %w: %s",
+				ErrConfig, path, err, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return Collector{}, fmt.Errorf("%w: generator %s failed: %w", ErrConfig, path, err)
+	}
+
+	c := Collector{Meta: MetaOptions{Enabled: true}}
+	if _, err := toml.Decode(string(out), &c); err != nil {
+		return c, fmt.Errorf("%w: could not parse output of generator %s: %w",
+			ErrConfig, path, err)
+	}
+	if c.Meta.ID == "" {
+		return c, fmt.Errorf("%w: generator %s: %w", ErrConfig, path, errMissingID)
+	}
+	if err := finishCollector(&c, path); err != nil {
+		return c, err
+	}
+	return c, nil
+}
@@ -0,0 +1,80 @@
+package insights
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeGenerator writes an executable generator script into dir.
+func writeGenerator(t *testing.T, dir, name, script string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGeneratedCollectors(t *testing.T) {
+	t.Setenv("CONFIG_DIR", t.TempDir())
+	dir := t.TempDir()
+	t.Setenv("GENERATORS_DIR", dir)
+
+	writeGenerator(t, dir, "entitled", `#!/bin/sh
+cat <<EOF
+[meta]
+id = "entitled"
+
+[exec]
+command = ["/bin/true"]
+EOF
+`)
+	// A broken generator is skipped, not fatal.
+	writeGenerator(t, dir, "broken", "#!/bin/sh\nexit 1\n")
+
+	collectors, err := GetCollectors()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(collectors) != 1 || collectors[0].Meta.ID != "entitled" {
+		t.Fatalf("unexpected collectors: %v", collectors)
+	}
+	if collectors[0].Generated.Path != filepath.Join(dir, "entitled") {
+		t.Errorf("generated collector does not name its generator: %q",
+			collectors[0].Generated.Path)
+	}
+}
+
+func TestGeneratedCollectorsStaticWins(t *testing.T) {
+	configDir := t.TempDir()
+	t.Setenv("CONFIG_DIR", configDir)
+	dir := t.TempDir()
+	t.Setenv("GENERATORS_DIR", dir)
+
+	writeCollector(t, configDir, "example.toml", `
+[meta]
+id = "example"
+
+[exec]
+command = ["/bin/echo", "static"]
+`)
+	writeGenerator(t, dir, "example", `#!/bin/sh
+cat <<EOF
+[meta]
+id = "example"
+
+[exec]
+command = ["/bin/echo", "generated"]
+EOF
+`)
+
+	collectors, err := GetCollectors()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(collectors) != 1 {
+		t.Fatalf("unexpected collectors: %v", collectors)
+	}
+	if got := collectors[0].Exec.Command[1]; got != "static" {
+		t.Errorf("static definition did not win over the generator: %q", got)
+	}
+}
@@ -0,0 +1,8 @@
+module github.com/RedHatInsights/rhc-insights
+
+go 1.21
+
+require (
+	github.com/BurntSushi/toml v1.5.0
+	github.com/urfave/cli/v3 v3.3.3
+)
@@ -0,0 +1,123 @@
+package insights
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LastRun describes the most recent run of a collector.
+type LastRun struct {
+	// Time is when the run finished.
+	Time time.Time `json:"time"`
+	// ExitStatus is the result of the run: zero for success, positive
+	// for failure and negative when the status is not known (records
+	// written by older versions carry no status).
+	ExitStatus int `json:"exit_status"`
+	// Duration is how long the run took.
+	Duration time.Duration `json:"duration"`
+	// ArchiveSize is the size in bytes of the uploaded archive, or
+	// zero when no archive was produced.
+	ArchiveSize int64 `json:"archive_size"`
+	// ContentHash is the hash of the collected data that was uploaded,
+	// used to skip uploads of unchanged content.
+	ContentHash string `json:"content_hash,omitempty"`
+}
+
+// MarshalJSON renders the record with its time normalized to UTC and
+// an additional raw Unix timestamp, so JSON consumers never have to
+// reason about the host's timezone.
+func (l LastRun) MarshalJSON() ([]byte, error) {
+	type alias LastRun
+	record := struct {
+		alias
+		TimeUnix int64 `json:"time_unix"`
+	}{alias: alias(l)}
+	if !l.Time.IsZero() {
+		record.Time = l.Time.UTC()
+		record.TimeUnix = l.Time.Unix()
+	}
+	return json.Marshal(record)
+}
+
+// Succeeded reports whether the run completed successfully.
+func (l LastRun) Succeeded() bool {
+	return l.ExitStatus == 0
+}
+
+// lastRunPath returns the path of the collector's last-run record.
+func lastRunPath(id string) string {
+	return filepath.Join(CacheDir(), id+".last-run")
+}
+
+// SetLastRun stores the given record as the collector's last run. The
+// record's time is set to the current time when it is zero.
+func SetLastRun(id string, last LastRun) error {
+	// The record can carry run metadata that should not be readable
+	// by other users, so keep both the directory and file private.
+	if err := os.MkdirAll(CacheDir(), 0o700); err != nil {
+		return fmt.Errorf("could not create cache directory: %w", err)
+	}
+	if last.Time.IsZero() {
+		last.Time = time.Now()
+	}
+	data, err := json.Marshal(last)
+	if err != nil {
+		return fmt.Errorf("could not encode last run: %w", err)
+	}
+	if err := os.WriteFile(lastRunPath(id), data, 0o600); err != nil {
+		return fmt.Errorf("could not record last run: %w", err)
+	}
+	return nil
+}
+
+// GetLastRun returns the collector's last-run record. It returns a
+// record with the zero time when the collector has never run. Records
+// written by older versions, which contain only a Unix timestamp, are
+// read as having an unknown outcome.
+func GetLastRun(id string) (LastRun, error) {
+	data, err := os.ReadFile(lastRunPath(id))
+	if errors.Is(err, fs.ErrNotExist) {
+		return LastRun{ExitStatus: -1}, nil
+	}
+	if err != nil {
+		return LastRun{}, fmt.Errorf("could not read last run: %w", err)
+	}
+
+	if strings.HasPrefix(strings.TrimSpace(string(data)), "{") {
+		var last LastRun
+		if err := json.Unmarshal(data, &last); err != nil {
+			return LastRun{}, fmt.Errorf("could not parse last run: %w", err)
+		}
+		return last, nil
+	}
+	return parseLegacyLastRun(data)
+}
+
+// parseLegacyLastRun reads the pre-JSON record formats: a plain Unix
+// timestamp, optionally followed by an exit status.
+func parseLegacyLastRun(data []byte) (LastRun, error) {
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return LastRun{}, fmt.Errorf("could not parse last run: empty record")
+	}
+	ts, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return LastRun{}, fmt.Errorf("could not parse last run: %w", err)
+	}
+	last := LastRun{Time: time.Unix(ts, 0), ExitStatus: -1}
+	if len(fields) > 1 {
+		status, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return LastRun{}, fmt.Errorf("could not parse last run: %w", err)
+		}
+		last.ExitStatus = status
+	}
+	return last, nil
+}
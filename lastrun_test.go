@@ -0,0 +1,83 @@
+package insights
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLastRun(t *testing.T) {
+	t.Setenv("CACHE_DIR", t.TempDir())
+
+	last, err := GetLastRun("example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !last.Time.IsZero() {
+		t.Errorf("expected zero time before first run, got %v", last.Time)
+	}
+
+	record := LastRun{
+		Duration:    3 * time.Second,
+		ArchiveSize: 4096,
+	}
+	if err := SetLastRun("example", record); err != nil {
+		t.Fatal(err)
+	}
+
+	last, err = GetLastRun("example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(last.Time) > time.Minute {
+		t.Errorf("unexpected last run time: %v", last.Time)
+	}
+	if !last.Succeeded() {
+		t.Errorf("expected a successful record, got exit status %d", last.ExitStatus)
+	}
+	if last.Duration != 3*time.Second || last.ArchiveSize != 4096 {
+		t.Errorf("record not preserved: %+v", last)
+	}
+
+	info, err := os.Stat(lastRunPath("example"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("expected mode 0600, got %v", info.Mode().Perm())
+	}
+
+	if err := SetLastRun("example", LastRun{ExitStatus: 3}); err != nil {
+		t.Fatal(err)
+	}
+	last, err = GetLastRun("example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last.Succeeded() || last.ExitStatus != 3 {
+		t.Errorf("expected exit status 3, got %d", last.ExitStatus)
+	}
+}
+
+func TestGetLastRunOldFormat(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("CACHE_DIR", dir)
+
+	// Records written by older versions contain only a timestamp.
+	if err := os.WriteFile(filepath.Join(dir, "old.last-run"),
+		[]byte("1700000000"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	last, err := GetLastRun("old")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last.Time.Unix() != 1700000000 {
+		t.Errorf("unexpected last run time: %v", last.Time)
+	}
+	if last.ExitStatus >= 0 {
+		t.Errorf("expected unknown exit status, got %d", last.ExitStatus)
+	}
+}
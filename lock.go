@@ -0,0 +1,50 @@
+package insights
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// collectorLock holds the advisory lock serializing runs of one
+// collector, so a manual run and a timer firing at the same moment
+// cannot race on the collection directory or the last-run cache.
+type collectorLock struct {
+	f *os.File
+}
+
+// lockCollector takes the per-collector advisory lock, a flock on a
+// file under CacheDir. With wait set the call blocks until a
+// concurrent run finishes; otherwise a held lock yields ErrBusy. The
+// lock is advisory: only rhc processes respect it.
+func lockCollector(id string, wait bool) (*collectorLock, error) {
+	dir := filepath.Join(CacheDir(), "locks")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("could not create lock directory: %w", err)
+	}
+	f, err := os.OpenFile(filepath.Join(dir, id+".lock"), os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("could not open lock file: %w", err)
+	}
+
+	how := syscall.LOCK_EX
+	if !wait {
+		how |= syscall.LOCK_NB
+	}
+	if err := syscall.Flock(int(f.Fd()), how); err != nil {
+		f.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, fmt.Errorf("%w: %s", ErrBusy, id)
+		}
+		return nil, fmt.Errorf("could not lock collector %s: %w", id, err)
+	}
+	return &collectorLock{f: f}, nil
+}
+
+// unlock releases the lock.
+func (l *collectorLock) unlock() {
+	syscall.Flock(int(l.f.Fd()), syscall.LOCK_UN)
+	l.f.Close()
+}
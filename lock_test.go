@@ -0,0 +1,35 @@
+package insights
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLockCollector(t *testing.T) {
+	t.Setenv("CACHE_DIR", t.TempDir())
+
+	lock, err := lockCollector("example", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The lock is held by this process, so a second non-waiting
+	// attempt must fail fast.
+	if _, err := lockCollector("example", false); !errors.Is(err, ErrBusy) {
+		t.Errorf("expected ErrBusy, got %v", err)
+	}
+
+	// A different collector is unaffected.
+	other, err := lockCollector("other", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other.unlock()
+
+	lock.unlock()
+	relock, err := lockCollector("example", false)
+	if err != nil {
+		t.Fatalf("expected the released lock to be available: %v", err)
+	}
+	relock.unlock()
+}
@@ -0,0 +1,90 @@
+package insights
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// metricsPath returns the textfile a collector's metrics are written
+// to.
+func metricsPath(dir, id string) string {
+	return filepath.Join(dir, "rhc_collector_"+id+".prom")
+}
+
+// WriteMetrics records the outcome of a collector run in Prometheus
+// textfile exposition format under dir, one file per collector, for
+// node_exporter's textfile collector. The success/failure counters
+// are carried over from the previous file so they keep counting
+// across runs.
+func WriteMetrics(dir string, c Collector, result RunResult, runErr error) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("could not create metrics directory: %w", err)
+	}
+	path := metricsPath(dir, c.Meta.ID)
+
+	success, failure := readRunCounters(path)
+	if runErr != nil {
+		failure++
+	} else {
+		success++
+	}
+
+	var b strings.Builder
+	label := fmt.Sprintf("{collector=%q}", c.Meta.ID)
+	fmt.Fprintf(&b, "# HELP rhc_collector_collect_duration_seconds Time the collector command took.\n")
+	fmt.Fprintf(&b, "# TYPE rhc_collector_collect_duration_seconds gauge\n")
+	fmt.Fprintf(&b, "rhc_collector_collect_duration_seconds%s %g\n", label, result.CollectDuration.Seconds())
+	fmt.Fprintf(&b, "# HELP rhc_collector_upload_duration_seconds Time the archive upload took.\n")
+	fmt.Fprintf(&b, "# TYPE rhc_collector_upload_duration_seconds gauge\n")
+	fmt.Fprintf(&b, "rhc_collector_upload_duration_seconds%s %g\n", label, result.UploadDuration.Seconds())
+	fmt.Fprintf(&b, "# HELP rhc_collector_archive_size_bytes Size of the produced archive.\n")
+	fmt.Fprintf(&b, "# TYPE rhc_collector_archive_size_bytes gauge\n")
+	fmt.Fprintf(&b, "rhc_collector_archive_size_bytes%s %d\n", label, result.ArchiveSize)
+	fmt.Fprintf(&b, "# HELP rhc_collector_runs_total Collector runs by result.\n")
+	fmt.Fprintf(&b, "# TYPE rhc_collector_runs_total counter\n")
+	fmt.Fprintf(&b, "rhc_collector_runs_total{collector=%q,result=\"success\"} %d\n", c.Meta.ID, success)
+	fmt.Fprintf(&b, "rhc_collector_runs_total{collector=%q,result=\"failure\"} %d\n", c.Meta.ID, failure)
+
+	// Write-then-rename so the textfile collector never scrapes a
+	// half-written file.
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(b.String()), 0o644); err != nil {
+		return fmt.Errorf("could not write metrics: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("could not write metrics: %w", err)
+	}
+	return nil
+}
+
+// readRunCounters reads the run counters back from a previously
+// written metrics file. A missing or unreadable file yields zeros.
+func readRunCounters(path string) (success, failure int64) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, 0
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if !strings.HasPrefix(line, "rhc_collector_runs_total{") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		value, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		switch {
+		case strings.Contains(fields[0], `result="success"`):
+			success = value
+		case strings.Contains(fields[0], `result="failure"`):
+			failure = value
+		}
+	}
+	return success, failure
+}
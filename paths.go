@@ -0,0 +1,95 @@
+package insights
+
+import (
+	"os"
+	"path/filepath"
+)
+
+const (
+	defaultVendorConfigDir = "/usr/lib/rhc/collectors"
+	defaultConfigDir       = "/etc/rhc/collectors"
+	defaultCacheDir        = "/var/cache/rhc/collectors"
+	defaultCollectionsDir  = "/var/lib/rhc/collections"
+	defaultGeneratorsDir   = "/usr/lib/rhc/generators"
+)
+
+// ConfigDirs returns the search path of collector definition
+// directories in increasing precedence: vendor defaults first, the
+// admin directory last, so a definition with the same ID in a later
+// directory overrides an earlier one. The path can be overridden with
+// the CONFIG_DIR environment variable or the configuration file, both
+// of which take a list separated by the platform's list separator.
+func ConfigDirs() []string {
+	if dirs := os.Getenv("CONFIG_DIR"); dirs != "" {
+		return filepath.SplitList(dirs)
+	}
+	if currentConfig.ConfigDir != "" {
+		return filepath.SplitList(currentConfig.ConfigDir)
+	}
+	return []string{defaultVendorConfigDir, defaultConfigDir}
+}
+
+// ConfigDir returns the directory admin-made collector definitions
+// belong in: the last, highest-precedence entry of ConfigDirs.
+func ConfigDir() string {
+	dirs := ConfigDirs()
+	return dirs[len(dirs)-1]
+}
+
+// GeneratorsDir returns the directory of collector generators:
+// executables that emit collector definitions as TOML on standard
+// output. Resolved like ConfigDir but from GENERATORS_DIR.
+func GeneratorsDir() string {
+	if dir := os.Getenv("GENERATORS_DIR"); dir != "" {
+		return dir
+	}
+	if currentConfig.GeneratorsDir != "" {
+		return currentConfig.GeneratorsDir
+	}
+	return defaultGeneratorsDir
+}
+
+// CacheDir returns the directory that holds collector state such as
+// last-run records, resolved like ConfigDir but from CACHE_DIR. For
+// unprivileged users it falls back to the user's own cache directory
+// ($XDG_CACHE_HOME or ~/.cache) so state is not written to (or leaked
+// from) the system-wide location.
+func CacheDir() string {
+	if dir := os.Getenv("CACHE_DIR"); dir != "" {
+		return dir
+	}
+	if currentConfig.CacheDir != "" {
+		return currentConfig.CacheDir
+	}
+	if os.Geteuid() != 0 {
+		if base, err := os.UserCacheDir(); err == nil {
+			return filepath.Join(base, "rhc", "collectors")
+		}
+	}
+	return defaultCacheDir
+}
+
+// CollectionsDir returns the directory under which collectors write
+// their data before it is archived, resolved like ConfigDir but from
+// COLLECTIONS_DIR. For unprivileged users it falls back to
+// $XDG_RUNTIME_DIR, so per-user collections stay out of the
+// system-wide location and are cleaned up on logout, with
+// $XDG_CACHE_HOME as the fallback on sessions without a runtime
+// directory.
+func CollectionsDir() string {
+	if dir := os.Getenv("COLLECTIONS_DIR"); dir != "" {
+		return dir
+	}
+	if currentConfig.CollectionsDir != "" {
+		return currentConfig.CollectionsDir
+	}
+	if os.Geteuid() != 0 {
+		if runtime := os.Getenv("XDG_RUNTIME_DIR"); runtime != "" {
+			return filepath.Join(runtime, "rhc", "collections")
+		}
+		if base, err := os.UserCacheDir(); err == nil {
+			return filepath.Join(base, "rhc", "collections")
+		}
+	}
+	return defaultCollectionsDir
+}
@@ -0,0 +1,111 @@
+package insights
+
+import (
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// redactedPlaceholder replaces the text matched by a scrub pattern.
+const redactedPlaceholder = "[REDACTED]"
+
+// Redact applies the collector's [exec.redact] settings to the
+// collected directory before it is archived: files matching one of
+// the exclude globs are removed, and lines matching one of the scrub
+// patterns have the matched text replaced. It returns how many files
+// were removed and how many lines were scrubbed.
+func Redact(c Collector, directory string) (files, lines int, err error) {
+	redact := c.Exec.Redact
+	if len(redact.ExcludeFiles) == 0 && len(redact.ScrubPatterns) == 0 {
+		return 0, 0, nil
+	}
+
+	patterns := make([]*regexp.Regexp, 0, len(redact.ScrubPatterns))
+	for _, pattern := range redact.ScrubPatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return 0, 0, fmt.Errorf("%w: collector %s: invalid scrub pattern %q: %w",
+				ErrConfig, c.Meta.ID, pattern, err)
+		}
+		patterns = append(patterns, re)
+	}
+
+	err = filepath.WalkDir(directory, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(directory, path)
+		if err != nil {
+			return err
+		}
+		for _, glob := range redact.ExcludeFiles {
+			match, err := filepath.Match(glob, rel)
+			if err != nil {
+				return fmt.Errorf("invalid exclude glob %q: %w", glob, err)
+			}
+			if !match {
+				// Let a bare glob like "*.key" apply anywhere in the
+				// tree, not just at the top level.
+				match, _ = filepath.Match(glob, filepath.Base(rel))
+			}
+			if match {
+				files++
+				return os.Remove(path)
+			}
+		}
+		scrubbed, err := scrubFile(path, patterns)
+		lines += scrubbed
+		return err
+	})
+	if err != nil {
+		return files, lines, fmt.Errorf("could not redact %s: %w", directory, err)
+	}
+
+	if files > 0 || lines > 0 {
+		slog.Info("redacted collected data", "id", c.Meta.ID,
+			"files-removed", files, "lines-scrubbed", lines)
+	}
+	return files, lines, nil
+}
+
+// scrubFile replaces pattern matches in the file line by line and
+// returns the number of lines that were changed. The file is only
+// rewritten when something matched.
+func scrubFile(path string, patterns []*regexp.Regexp) (int, error) {
+	if len(patterns) == 0 {
+		return 0, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+
+	scrubbed := 0
+	lines := strings.Split(string(data), "\n")
+	for i, line := range lines {
+		changed := false
+		for _, re := range patterns {
+			if re.MatchString(line) {
+				line = re.ReplaceAllString(line, redactedPlaceholder)
+				changed = true
+			}
+		}
+		if changed {
+			lines[i] = line
+			scrubbed++
+		}
+	}
+	if scrubbed == 0 {
+		return 0, nil
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return scrubbed, err
+	}
+	return scrubbed, os.WriteFile(path, []byte(strings.Join(lines, "\n")), info.Mode())
+}
@@ -0,0 +1,69 @@
+package insights
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	directory := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(directory, "sub"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	write := func(name, content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(directory, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("config", "host = example.com\npassword = hunter2\n")
+	write("server.key", "secret")
+	write(filepath.Join("sub", "other.key"), "secret")
+
+	c := Collector{Meta: MetaOptions{ID: "redacted"}}
+	c.Exec.Redact = RedactOptions{
+		ExcludeFiles:  []string{"*.key"},
+		ScrubPatterns: []string{`password = \S+`},
+	}
+
+	files, lines, err := Redact(c, directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if files != 2 {
+		t.Errorf("expected 2 removed files, got %d", files)
+	}
+	if lines != 1 {
+		t.Errorf("expected 1 scrubbed line, got %d", lines)
+	}
+
+	if _, err := os.Stat(filepath.Join(directory, "server.key")); err == nil {
+		t.Error("expected server.key to be removed")
+	}
+	if _, err := os.Stat(filepath.Join(directory, "sub", "other.key")); err == nil {
+		t.Error("expected sub/other.key to be removed")
+	}
+	data, err := os.ReadFile(filepath.Join(directory, "config"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "host = example.com\n[REDACTED]\n" {
+		t.Errorf("unexpected scrubbed content: %q", data)
+	}
+}
+
+func TestRedactNothingConfigured(t *testing.T) {
+	directory := t.TempDir()
+	if err := os.WriteFile(filepath.Join(directory, "data"), []byte("x"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	files, lines, err := Redact(Collector{}, directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if files != 0 || lines != 0 {
+		t.Errorf("expected nothing to be affected, got %d files, %d lines", files, lines)
+	}
+}
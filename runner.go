@@ -0,0 +1,370 @@
+package insights
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// RunOptions shape a collection cycle performed by a Runner.
+type RunOptions struct {
+	// MaxArchiveSize is the archive size limit in bytes; zero disables
+	// it.
+	MaxArchiveSize int64
+	// Keep retains the collection directory after the run.
+	Keep bool
+	// KeepOnFailure retains the collection directory when the run
+	// fails, so the partial data can be inspected; successful runs
+	// still clean up. The kept path is reported in the error.
+	KeepOnFailure bool
+	// KeepUploaded retains the archive even after a successful upload.
+	KeepUploaded bool
+	// NoUpload skips the upload; the archive is retained instead.
+	NoUpload bool
+	// OnlyIfChanged skips the upload when the collected data matches
+	// the last uploaded content; Force overrides it.
+	OnlyIfChanged bool
+	Force         bool
+	// UploadTimeout bounds the HTTP exchange with Ingress; zero
+	// disables it.
+	UploadTimeout time.Duration
+	// ExtraArgs are appended to the collector's command. The
+	// collector must opt in with exec.allow_args.
+	ExtraArgs []string
+	// MetricsDir, when set, is where run metrics are written in
+	// Prometheus textfile format.
+	MetricsDir string
+	// AuditLog, when set, is the file every upload attempt is
+	// recorded in as a JSON line; empty falls back to AuditLogPath.
+	AuditLog string
+	// CompressionLevel is the gzip level archives are compressed
+	// with, 1 (fastest) to 9 (smallest); zero picks gzip's default.
+	CompressionLevel int
+	// Scheduled marks a run triggered by a timer rather than an
+	// operator. Scheduled runs respect the upload circuit breaker:
+	// after repeated upload failures they are skipped for a cool-down
+	// period instead of collecting data that cannot be delivered.
+	// Manual runs always proceed.
+	Scheduled bool
+	// Wait blocks behind a concurrent run of the same collector
+	// instead of failing with ErrBusy. Waiting ignores ctx: the lock
+	// is taken before the run's pipeline starts.
+	Wait bool
+	// Reproducible normalizes archive metadata so identical collected
+	// data compresses to identical bytes; see Compress.
+	Reproducible bool
+	// Stream sends the compressed archive straight to Ingress
+	// without writing it to disk, halving the disk I/O of large
+	// collections. It cannot be combined with options that need the
+	// archive as a file (NoUpload, KeepUploaded, MaxArchiveSize),
+	// produces no checksum or manifest, and a failed upload cannot
+	// be spooled.
+	Stream bool
+}
+
+// RunResult describes what one collection cycle produced.
+type RunResult struct {
+	// Command is the effective argument vector the collector ran,
+	// extra arguments included.
+	Command []string
+	// ArchiveSize is the size of the produced archive in bytes.
+	ArchiveSize int64
+	// RequestID is the ID Ingress assigned to the upload.
+	RequestID string
+	// Archive is the path of the retained archive, or empty when it
+	// was cleaned up.
+	Archive string
+	// Checksum is the hex-encoded SHA-256 digest of the archive. It
+	// doubles as the idempotency key sent with every upload attempt.
+	Checksum string
+	// Manifest lists the files packed into the archive.
+	Manifest []string
+	// ManifestEntries detail each collected file with its size and
+	// SHA-256 digest, mirroring the manifest.json packed into the
+	// archive.
+	ManifestEntries []ManifestEntry
+	// ContentHash identifies the collected data independently of file
+	// timestamps.
+	ContentHash string
+	// Unchanged marks a skipped upload of unchanged data.
+	Unchanged bool
+	// Skipped marks a scheduled run that did not collect at all
+	// because the upload circuit breaker was open.
+	Skipped bool
+	// CollectDuration and UploadDuration time the two expensive
+	// pipeline stages. UploadDuration is total wall time across all
+	// attempts.
+	CollectDuration time.Duration
+	UploadDuration  time.Duration
+	// UploadAttempts counts the upload attempts made and
+	// LastUploadDuration times only the final one, so total and
+	// per-attempt timing stay distinguishable once uploads are
+	// retried.
+	UploadAttempts     int
+	LastUploadDuration time.Duration
+}
+
+// Runner performs the full collection pipeline — collect, redact,
+// compress, upload — and records each run's outcome in the last-run
+// cache. It exists so programs other than the rhc CLI can embed the
+// same behavior.
+type Runner struct {
+	// Options shape every run the Runner performs.
+	Options RunOptions
+}
+
+// Run performs one collection cycle for the collector and records its
+// outcome in the last-run cache.
+func (r Runner) Run(ctx context.Context, c Collector) (RunResult, error) {
+	// Serialize runs per collector, so a manual run and a firing
+	// timer cannot race on the collection directory or the last-run
+	// record.
+	lock, err := lockCollector(c.Meta.ID, r.Options.Wait)
+	if err != nil {
+		return RunResult{}, err
+	}
+	defer lock.unlock()
+
+	start := time.Now()
+	result, err := r.run(ctx, c)
+	if result.Skipped {
+		// A breaker-skipped run never collected anything: recording it
+		// would overwrite the real last run with a fake success and
+		// blank the content hash that unchanged-detection relies on.
+		return result, err
+	}
+	last := LastRun{
+		Duration:    time.Since(start),
+		ArchiveSize: result.ArchiveSize,
+		ContentHash: result.ContentHash,
+	}
+	if err != nil {
+		last.ExitStatus = 1
+	}
+	if lastErr := SetLastRun(c.Meta.ID, last); lastErr != nil {
+		slog.Warn("could not record last run", "id", c.Meta.ID, "error", lastErr)
+	}
+	if r.Options.MetricsDir != "" {
+		if metricsErr := WriteMetrics(r.Options.MetricsDir, c, result, err); metricsErr != nil {
+			slog.Warn("could not write metrics", "id", c.Meta.ID, "error", metricsErr)
+		}
+	}
+	return result, err
+}
+
+// run collects, redacts, compresses and uploads a collector's data.
+func (r Runner) run(ctx context.Context, c Collector) (result RunResult, rerr error) {
+	if r.Options.Scheduled && !r.Options.NoUpload {
+		if until, open := breakerOpen(); open {
+			slog.Warn("skipping scheduled run, too many recent upload failures",
+				"id", c.Meta.ID, "until", until.Format(time.RFC3339))
+			result.Skipped = true
+			return result, nil
+		}
+	}
+
+	if len(r.Options.ExtraArgs) > 0 {
+		if len(c.Exec.Steps) > 0 {
+			return result, fmt.Errorf(
+				"%w: extra arguments cannot be used with a multi-step collector",
+				ErrConfig)
+		}
+		if !c.Exec.AllowArgs {
+			return result, fmt.Errorf(
+				"%w: collector %s does not allow extra arguments (set exec.allow_args)",
+				ErrConfig, c.Meta.ID)
+		}
+		command := make([]string, 0, len(c.Exec.Command)+len(r.Options.ExtraArgs))
+		command = append(command, c.Exec.Command...)
+		c.Exec.Command = append(command, r.Options.ExtraArgs...)
+	}
+	result.Command = c.Exec.Command
+
+	collectStart := time.Now()
+	directory, err := Collect(ctx, c)
+	result.CollectDuration = time.Since(collectStart)
+	if err != nil {
+		if directory != "" {
+			if !r.Options.Keep && !r.Options.KeepOnFailure {
+				cleanup(directory)
+				return result, err
+			}
+			return result, fmt.Errorf("%w (collected data kept in %s)", err, directory)
+		}
+		return result, err
+	}
+	retainDirectory := false
+	if !r.Options.Keep {
+		defer func() {
+			if rerr != nil && r.Options.KeepOnFailure {
+				rerr = fmt.Errorf("%w (collected data kept in %s)", rerr, directory)
+				return
+			}
+			if retainDirectory {
+				return
+			}
+			cleanup(directory)
+		}()
+	}
+
+	if _, _, err := Redact(c, directory); err != nil {
+		return result, err
+	}
+
+	result.ContentHash, err = ContentHash(directory)
+	if err != nil {
+		return result, err
+	}
+
+	if r.Options.OnlyIfChanged && !r.Options.Force && !r.Options.NoUpload {
+		unchanged, err := r.unchanged(c, result.ContentHash)
+		if err != nil {
+			return result, err
+		}
+		if unchanged {
+			result.Unchanged = true
+			return result, nil
+		}
+	}
+
+	// The manifest rides inside the archive, recording what exactly is
+	// uploaded. It is written after the content hash so identical data
+	// keeps hashing the same.
+	result.ManifestEntries, err = WriteManifest(directory)
+	if err != nil {
+		return result, err
+	}
+
+	if r.Options.Stream {
+		if r.Options.NoUpload || r.Options.KeepUploaded || r.Options.MaxArchiveSize > 0 {
+			return result, fmt.Errorf(
+				"%w: streaming cannot be combined with options that need the archive on disk",
+				ErrConfig)
+		}
+		stream := CompressStream(ctx, directory, r.Options.CompressionLevel, r.Options.Reproducible)
+		defer stream.Close()
+		uploadStart := time.Now()
+		result.RequestID, err = UploadStream(ctx, uploadTarget(c), stream,
+			filepath.Base(directory)+".tar.gz", c.Upload.ContentType, r.Options.UploadTimeout)
+		result.UploadDuration = time.Since(uploadStart)
+		result.UploadAttempts = 1
+		result.LastUploadDuration = result.UploadDuration
+		recordUploadResult(err)
+		auditUpload(r.Options.AuditLog, c, uploadTarget(c), result, err)
+		return result, err
+	}
+
+	inTmpfs := tmpfsBacked(c)
+	archivePath := directory + ".tar.gz"
+	if inTmpfs {
+		// The archive has to stay inside the tmpfs mount, or the
+		// compressed data would land on persistent disk after all.
+		archivePath = filepath.Join(directory, filepath.Base(directory)+".tar.gz")
+	}
+	archive, manifest, err := compressInto(ctx, directory, archivePath,
+		r.Options.CompressionLevel, r.Options.Reproducible)
+	if err != nil {
+		return result, err
+	}
+	result.Manifest = manifest
+	keepArchive := r.Options.KeepUploaded || r.Options.NoUpload
+	if !keepArchive {
+		defer cleanup(archive)
+	} else {
+		result.Archive = archive
+		if inTmpfs {
+			// The retained archive lives inside the mount; removing
+			// the directory would take it along. Keep both — they
+			// still vanish with the tmpfs on reboot.
+			retainDirectory = true
+		}
+	}
+
+	if info, err := os.Stat(archive); err == nil {
+		result.ArchiveSize = info.Size()
+	}
+	result.Checksum, err = fileChecksum(archive)
+	if err != nil {
+		return result, err
+	}
+
+	if r.Options.NoUpload {
+		return result, nil
+	}
+	if r.Options.MaxArchiveSize > 0 && result.ArchiveSize > r.Options.MaxArchiveSize {
+		return result, fmt.Errorf(
+			"%w: archive is %d bytes, above the %d byte limit",
+			ErrUpload, result.ArchiveSize, r.Options.MaxArchiveSize)
+	}
+	uploadStart := time.Now()
+	result.RequestID, err = UploadTo(ctx, uploadTarget(c), archive, c.Upload.ContentType, r.Options.UploadTimeout)
+	result.UploadDuration = time.Since(uploadStart)
+	result.UploadAttempts = 1
+	result.LastUploadDuration = result.UploadDuration
+	recordUploadResult(err)
+	auditUpload(r.Options.AuditLog, c, uploadTarget(c), result, err)
+	if err != nil && errors.Is(err, ErrUpload) && !keepArchive {
+		if inTmpfs {
+			// Spooling would copy the archive to persistent storage,
+			// the very thing a tmpfs collection promises not to do.
+			slog.Warn("upload failed, not spooling a tmpfs collection", "id", c.Meta.ID)
+			return result, err
+		}
+		// Keep the data for a later flush instead of losing it with
+		// the collection directory.
+		spooled, spoolErr := SpoolArchive(archive, c.Upload.ContentType, c.Upload.URL)
+		if spoolErr != nil {
+			slog.Warn("could not spool archive", "id", c.Meta.ID, "error", spoolErr)
+		} else {
+			slog.Warn("upload failed, archive spooled for a later flush",
+				"id", c.Meta.ID, "archive", spooled)
+		}
+	}
+	return result, err
+}
+
+// unchanged reports whether the collected content hash matches the
+// last successful run's, meaning an upload would resend known data.
+func (r Runner) unchanged(c Collector, contentHash string) (bool, error) {
+	last, err := GetLastRun(c.Meta.ID)
+	if err != nil {
+		return false, err
+	}
+	if last.Succeeded() && last.ContentHash != "" && last.ContentHash == contentHash {
+		slog.Debug("collected data unchanged, skipping upload", "id", c.Meta.ID)
+		return true, nil
+	}
+	return false, nil
+}
+
+// fileChecksum returns the hex-encoded SHA-256 digest of the file.
+func fileChecksum(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("could not open %s: %w", path, err)
+	}
+	defer f.Close()
+	digest := sha256.New()
+	if _, err := io.Copy(digest, f); err != nil {
+		return "", fmt.Errorf("could not checksum %s: %w", path, err)
+	}
+	return hex.EncodeToString(digest.Sum(nil)), nil
+}
+
+// cleanup deletes path and logs a warning when that fails. A tmpfs
+// mount backing a collection directory is dropped first; on anything
+// that is not a mount point the unmount fails and is ignored.
+func cleanup(path string) {
+	_ = syscall.Unmount(path, 0)
+	if err := os.RemoveAll(path); err != nil {
+		slog.Warn("could not clean up", "path", path, "error", err)
+	}
+}
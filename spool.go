@@ -0,0 +1,134 @@
+package insights
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// spoolDir returns the directory under CacheDir that holds archives
+// whose upload failed and is to be retried later.
+func spoolDir() string {
+	return filepath.Join(CacheDir(), "spool")
+}
+
+// SpooledArchive is an archive queued for a later upload attempt,
+// together with the content type it has to be uploaded with.
+type SpooledArchive struct {
+	Path        string `json:"path"`
+	ContentType string `json:"content-type"`
+	// URL is the endpoint the archive was meant for, recorded so a
+	// flush honors a collector's upload.url override; empty means the
+	// shared Ingress endpoint resolved at flush time.
+	URL string `json:"url,omitempty"`
+}
+
+// spoolMetaPath returns the sidecar file recording an archive's
+// upload metadata.
+func spoolMetaPath(archive string) string {
+	return archive + ".meta"
+}
+
+// SpoolArchive moves the archive into the spool queue so a later
+// flush can retry the upload, and returns the queued path. The
+// content type, and the destination override when there is one, are
+// recorded in a sidecar file next to the archive.
+func SpoolArchive(archive, contentType, url string) (string, error) {
+	dir := spoolDir()
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", fmt.Errorf("could not create spool directory: %w", err)
+	}
+
+	spooled := filepath.Join(dir, filepath.Base(archive))
+	if err := moveFile(archive, spooled); err != nil {
+		return "", fmt.Errorf("could not spool archive: %w", err)
+	}
+
+	meta, err := json.Marshal(SpooledArchive{Path: spooled, ContentType: contentType, URL: url})
+	if err != nil {
+		return "", fmt.Errorf("could not encode spool metadata: %w", err)
+	}
+	if err := os.WriteFile(spoolMetaPath(spooled), meta, 0o600); err != nil {
+		return "", fmt.Errorf("could not write spool metadata: %w", err)
+	}
+	return spooled, nil
+}
+
+// SpooledArchives returns the queued archives, oldest name first. A
+// missing spool directory yields an empty queue.
+func SpooledArchives() ([]SpooledArchive, error) {
+	entries, err := os.ReadDir(spoolDir())
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read spool directory: %w", err)
+	}
+
+	var spooled []SpooledArchive
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".meta") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(spoolDir(), entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("could not read spool metadata: %w", err)
+		}
+		var s SpooledArchive
+		if err := json.Unmarshal(data, &s); err != nil {
+			return nil, fmt.Errorf("could not parse spool metadata %s: %w", entry.Name(), err)
+		}
+		if _, err := os.Stat(s.Path); err != nil {
+			// Metadata without its archive is stale; skip it.
+			continue
+		}
+		spooled = append(spooled, s)
+	}
+	sort.Slice(spooled, func(i, j int) bool {
+		return spooled[i].Path < spooled[j].Path
+	})
+	return spooled, nil
+}
+
+// Discard removes the spooled archive and its metadata from the
+// queue.
+func (s SpooledArchive) Discard() error {
+	if err := os.Remove(s.Path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("could not remove spooled archive: %w", err)
+	}
+	if err := os.Remove(spoolMetaPath(s.Path)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("could not remove spool metadata: %w", err)
+	}
+	return nil
+}
+
+// moveFile renames src to dst, falling back to a copy when the two
+// are on different filesystems.
+func moveFile(src, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
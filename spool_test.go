@@ -0,0 +1,72 @@
+package insights
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSpoolArchive(t *testing.T) {
+	t.Setenv("CACHE_DIR", t.TempDir())
+
+	archive := filepath.Join(t.TempDir(), "os-release-1.tar.gz")
+	if err := os.WriteFile(archive, []byte("payload"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	spooled, err := SpoolArchive(archive, "application/vnd.redhat.test+tgz",
+		"https://edge.example.com/upload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(archive); err == nil {
+		t.Error("expected the original archive to be moved away")
+	}
+
+	queue, err := SpooledArchives()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(queue) != 1 {
+		t.Fatalf("expected 1 spooled archive, got %d", len(queue))
+	}
+	if queue[0].Path != spooled {
+		t.Errorf("unexpected path: %q", queue[0].Path)
+	}
+	if queue[0].ContentType != "application/vnd.redhat.test+tgz" {
+		t.Errorf("unexpected content type: %q", queue[0].ContentType)
+	}
+	if queue[0].URL != "https://edge.example.com/upload" {
+		t.Errorf("unexpected destination: %q", queue[0].URL)
+	}
+	data, err := os.ReadFile(queue[0].Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "payload" {
+		t.Errorf("unexpected archive content: %q", data)
+	}
+
+	if err := queue[0].Discard(); err != nil {
+		t.Fatal(err)
+	}
+	queue, err = SpooledArchives()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(queue) != 0 {
+		t.Errorf("expected an empty queue after discard, got %d entries", len(queue))
+	}
+}
+
+func TestSpooledArchivesEmpty(t *testing.T) {
+	t.Setenv("CACHE_DIR", filepath.Join(t.TempDir(), "does-not-exist"))
+
+	queue, err := SpooledArchives()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(queue) != 0 {
+		t.Errorf("expected an empty queue, got %d entries", len(queue))
+	}
+}
@@ -0,0 +1,273 @@
+package insights
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultUnitPrefix is the template unit collectors are scheduled
+// with unless the configuration names another.
+const defaultUnitPrefix = "rhc-collector"
+
+// unitPrefix returns the template unit prefix collectors map to:
+// the systemd.unit configuration value (with any trailing @
+// stripped) or the built-in default. A single template unit serves
+// every collector; the collector ID is the instance.
+func unitPrefix() string {
+	if unit := currentConfig.Systemd.Unit; unit != "" {
+		return strings.TrimSuffix(unit, "@")
+	}
+	return defaultUnitPrefix
+}
+
+// TimerUnit returns the systemd timer unit name for the collector ID.
+func TimerUnit(id string) string {
+	return fmt.Sprintf("%s@%s.timer", unitPrefix(), id)
+}
+
+// ServiceUnit returns the systemd service unit name for the collector ID.
+func ServiceUnit(id string) string {
+	return fmt.Sprintf("%s@%s.service", unitPrefix(), id)
+}
+
+// Timer describes the state of a collector's systemd timer.
+type Timer struct {
+	Unit string `json:"unit"`
+	// Loaded reports whether systemd knows the unit at all. A false
+	// value means the unit was never installed.
+	Loaded      bool      `json:"loaded"`
+	Enabled     bool      `json:"enabled"`
+	Active      bool      `json:"active"`
+	LastTrigger time.Time `json:"last_trigger"`
+	NextTrigger time.Time `json:"next_trigger"`
+	// RandomizedDelay is the random jitter systemd spreads
+	// activations by, zero when none is configured.
+	RandomizedDelay time.Duration `json:"randomized_delay,omitempty"`
+}
+
+// MarshalJSON renders the timer's trigger times in UTC, keeping JSON
+// output identical regardless of the host's timezone.
+func (t Timer) MarshalJSON() ([]byte, error) {
+	type alias Timer
+	t.LastTrigger = t.LastTrigger.UTC()
+	t.NextTrigger = t.NextTrigger.UTC()
+	return json.Marshal(alias(t))
+}
+
+// EnableTimer enables and starts the collector's systemd timer. With
+// user set, the timer is managed in the calling user's session
+// instead of the system instance. A non-zero delay installs a
+// drop-in spreading activations by up to that much random jitter
+// (systemd's RandomizedDelaySec), so whole fleets do not upload at
+// the exact same minute; zero removes a previously installed
+// drop-in.
+func EnableTimer(id string, user bool, delay time.Duration) error {
+	if !SchedulingAvailable() {
+		return ErrNoSystemd
+	}
+	if err := setTimerDelay(id, user, delay); err != nil {
+		return err
+	}
+	return systemctl(user, "enable", "--now", TimerUnit(id))
+}
+
+// timerDelayDropIn is the drop-in file name the randomized delay is
+// written to.
+const timerDelayDropIn = "90-rhc-randomized-delay.conf"
+
+// timerDropInPath returns the path of the randomized-delay drop-in
+// for the collector's timer unit.
+func timerDropInPath(id string, user bool) (string, error) {
+	if user {
+		base := os.Getenv("XDG_CONFIG_HOME")
+		if base == "" {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return "", fmt.Errorf("could not locate the user unit directory: %w", err)
+			}
+			base = filepath.Join(home, ".config")
+		}
+		return filepath.Join(base, "systemd", "user", TimerUnit(id)+".d", timerDelayDropIn), nil
+	}
+	return filepath.Join("/etc/systemd/system", TimerUnit(id)+".d", timerDelayDropIn), nil
+}
+
+// setTimerDelay installs or removes the drop-in carrying the timer's
+// randomized delay and reloads systemd when anything changed.
+func setTimerDelay(id string, user bool, delay time.Duration) error {
+	path, err := timerDropInPath(id, user)
+	if err != nil {
+		return err
+	}
+	if delay <= 0 {
+		if err := os.Remove(path); err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return fmt.Errorf("could not remove %s: %w", path, err)
+		}
+		return systemctl(user, "daemon-reload")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("could not create %s: %w", filepath.Dir(path), err)
+	}
+	content := fmt.Sprintf("# Installed by rhc collector enable.\n[Timer]\nRandomizedDelaySec=%d\n",
+		int64(delay.Seconds()))
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		return fmt.Errorf("could not write %s: %w", path, err)
+	}
+	return systemctl(user, "daemon-reload")
+}
+
+// DisableTimer disables the collector's systemd timer. With now set
+// a running timer is also stopped immediately; otherwise it keeps
+// running until the next boot, matching systemctl disable versus
+// disable --now. With user set, the timer is managed in the calling
+// user's session instead of the system instance.
+func DisableTimer(id string, user, now bool) error {
+	if !SchedulingAvailable() {
+		return ErrNoSystemd
+	}
+	args := []string{"disable"}
+	if now {
+		args = append(args, "--now")
+	}
+	return systemctl(user, append(args, TimerUnit(id))...)
+}
+
+// GetTimer returns the state of the collector's systemd timer, from
+// the user's session instance when user is set.
+func GetTimer(id string, user bool) (Timer, error) {
+	unit := TimerUnit(id)
+	timer := Timer{Unit: unit}
+	// Without systemd there is no timer state to query; report the
+	// unit as never installed so listing and inspecting collectors
+	// keeps working in containers and minimal environments.
+	if !SchedulingAvailable() {
+		return timer, nil
+	}
+
+	out, _ := systemctlOutput(user, "is-enabled", unit)
+	timer.Enabled = strings.TrimSpace(string(out)) == "enabled"
+
+	out, _ = systemctlOutput(user, "is-active", unit)
+	timer.Active = strings.TrimSpace(string(out)) == "active"
+
+	out, err := systemctlOutput(user, "show", unit,
+		"--property=LoadState,LastTriggerUSec,NextElapseUSecRealtime,RandomizedDelayUSec")
+	if err != nil {
+		return timer, fmt.Errorf("could not query timer %s: %w", unit, err)
+	}
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			continue
+		}
+		switch key {
+		case "LoadState":
+			timer.Loaded = value == "loaded"
+		case "LastTriggerUSec":
+			timer.LastTrigger = parseTimestamp(value)
+		case "NextElapseUSecRealtime":
+			timer.NextTrigger = parseTimestamp(value)
+		case "RandomizedDelayUSec":
+			timer.RandomizedDelay = parseSpan(value)
+		}
+	}
+	return timer, nil
+}
+
+// parseTimestamp parses systemd's textual timestamp format. It returns
+// the zero time for empty or "n/a" values.
+func parseTimestamp(value string) time.Time {
+	value = strings.TrimSpace(value)
+	if value == "" || value == "n/a" {
+		return time.Time{}
+	}
+	t, err := time.Parse("Mon 2006-01-02 15:04:05 MST", value)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// SchedulingAvailable reports whether systemd is present to manage
+// collector timers with. The detection runs once per process, so
+// every command degrades the same way on hosts without systemd:
+// running, listing and inspecting collectors works fully, scheduling
+// operations fail with ErrNoSystemd.
+func SchedulingAvailable() bool {
+	schedulingOnce.Do(func() {
+		if _, err := exec.LookPath("systemctl"); err != nil {
+			return
+		}
+		_, err := os.Stat("/run/systemd/system")
+		schedulingAvailable = err == nil
+	})
+	return schedulingAvailable
+}
+
+var (
+	schedulingOnce      sync.Once
+	schedulingAvailable bool
+)
+
+// systemdAvailable reports whether the host runs systemd and
+// systemd-run is installed, so callers can fall back to plain
+// execution elsewhere.
+func systemdAvailable() bool {
+	if _, err := exec.LookPath("systemd-run"); err != nil {
+		return false
+	}
+	_, err := os.Stat("/run/systemd/system")
+	return err == nil
+}
+
+// parseSpan parses systemd's textual time span format for the spans
+// rhc itself writes (e.g. "5min", "1h 30min"). Unknown spans yield
+// zero.
+func parseSpan(value string) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" || value == "0" {
+		return 0
+	}
+	value = strings.NewReplacer(" ", "", "min", "m", "sec", "s", "hour", "h").Replace(value)
+	span, err := time.ParseDuration(value)
+	if err != nil {
+		return 0
+	}
+	return span
+}
+
+// systemctlCmd builds a systemctl invocation, targeting the user
+// instance when user is set.
+func systemctlCmd(user bool, args ...string) *exec.Cmd {
+	if user {
+		args = append([]string{"--user"}, args...)
+	}
+	return exec.Command("systemctl", args...)
+}
+
+// systemctlOutput runs systemctl and returns its standard output.
+func systemctlOutput(user bool, args ...string) ([]byte, error) {
+	return systemctlCmd(user, args...).Output()
+}
+
+// systemctl runs systemctl, reporting combined output on failure.
+func systemctl(user bool, args ...string) error {
+	cmd := systemctlCmd(user, args...)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s: %w: %s",
+			strings.Join(cmd.Args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,22 @@
+package insights
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSpan(t *testing.T) {
+	cases := map[string]time.Duration{
+		"":         0,
+		"0":        0,
+		"n/a":      0,
+		"30s":      30 * time.Second,
+		"5min":     5 * time.Minute,
+		"1h 30min": 90 * time.Minute,
+	}
+	for value, want := range cases {
+		if got := parseSpan(value); got != want {
+			t.Errorf("parseSpan(%q) = %s, want %s", value, got, want)
+		}
+	}
+}
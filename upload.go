@@ -0,0 +1,577 @@
+package insights
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const defaultIngressURL = "https://cert.console.redhat.com/api/ingress/v1/upload"
+
+// DefaultMaxArchiveSize is the payload size limit enforced by the
+// Ingress service. Archives larger than this are rejected server-side
+// with 413, so there is no point in uploading them.
+const DefaultMaxArchiveSize int64 = 100 << 20
+
+const (
+	consumerCertPath = "/etc/pki/consumer/cert.pem"
+	consumerKeyPath  = "/etc/pki/consumer/key.pem"
+)
+
+// idempotencyHeader carries the upload's idempotency key: the
+// archive's SHA-256 digest. Retrying a timed-out upload resends the
+// same key, so the server can recognize an archive it already
+// accepted and deduplicate instead of ingesting it twice.
+const idempotencyHeader = "X-Rh-Idempotency-Key"
+
+// IngressURL returns the Ingress upload endpoint: the INGRESS_URL
+// environment variable, the configuration file value, or the built-in
+// default, in that order.
+func IngressURL() string {
+	if url := os.Getenv("INGRESS_URL"); url != "" {
+		return url
+	}
+	if currentConfig.IngressURL != "" {
+		return currentConfig.IngressURL
+	}
+	return defaultIngressURL
+}
+
+// Upload sends the archive to the Ingress service and returns the
+// request ID Ingress assigned to the upload, so a local run can be
+// correlated with what landed server-side. contentType is the MIME
+// type Ingress uses to route the payload to the right service. A
+// non-zero timeout bounds the HTTP exchange so a stalled connection
+// does not hang the run; ctx bounds the run as a whole.
+func Upload(ctx context.Context, archive, contentType string, timeout time.Duration) (string, error) {
+	return UploadTo(ctx, IngressURL(), archive, contentType, timeout)
+}
+
+// UploadTo is Upload against an explicit endpoint instead of the
+// shared Ingress one, for collectors that override their destination
+// with upload.url. Authentication is the configured one either way.
+func UploadTo(ctx context.Context, target, archive, contentType string, timeout time.Duration) (string, error) {
+	f, err := os.Open(archive)
+	if err != nil {
+		return "", fmt.Errorf("could not open archive: %w", err)
+	}
+	defer f.Close()
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", fmt.Sprintf(
+		`form-data; name="file"; filename="%s"`, filepath.Base(archive)))
+	header.Set("Content-Type", contentType)
+	part, err := writer.CreatePart(header)
+	if err != nil {
+		return "", fmt.Errorf("could not create multipart body: %w", err)
+	}
+	// Digest the archive while building the body; the digest doubles
+	// as the idempotency key for this and every retried attempt.
+	digest := sha256.New()
+	if _, err := io.Copy(part, io.TeeReader(f, digest)); err != nil {
+		return "", fmt.Errorf("could not read archive: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return "", fmt.Errorf("could not finalize multipart body: %w", err)
+	}
+
+	client, err := newIngressClient(timeout)
+	if err != nil {
+		return "", err
+	}
+
+	size := int64(body.Len())
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, throttle(&body))
+	if err != nil {
+		return "", fmt.Errorf("could not create upload request: %w", err)
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set(idempotencyHeader, hex.EncodeToString(digest.Sum(nil)))
+	setUploadHeaders(req)
+
+	slog.Debug("uploading archive", "archive", archive, "url", target)
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", uploadError(ctx, client, err)
+	}
+	defer resp.Body.Close()
+
+	slog.Debug("negotiated upload protocol", "proto", resp.Proto)
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		requestID := parseRequestID(data)
+		slog.Debug("upload accepted", "request_id", requestID)
+		return requestID, nil
+	case resp.StatusCode == http.StatusMovedPermanently,
+		resp.StatusCode == http.StatusFound,
+		resp.StatusCode == http.StatusTemporaryRedirect,
+		resp.StatusCode == http.StatusPermanentRedirect:
+		location := resp.Header.Get("Location")
+		if location == "" {
+			return "", fmt.Errorf("%w: %s without a Location header", ErrUpload, resp.Status)
+		}
+		// The redirect response may already carry the request ID.
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		requestID := parseRequestID(data)
+		if err := uploadPresigned(ctx, client, location, archive, contentType); err != nil {
+			return "", err
+		}
+		return requestID, nil
+	default:
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return "", fmt.Errorf("%w: %s: %s", ErrUpload, resp.Status, bytes.TrimSpace(data))
+	}
+}
+
+// UploadStream sends an archive read from r to the target endpoint,
+// streaming the multipart body so the payload never has to exist as
+// a file. filename is what the part is named after. Unlike Upload it
+// cannot follow a redirect to presigned storage, because the body
+// cannot be replayed; such deployments need the file-based path.
+func UploadStream(ctx context.Context, target string, r io.Reader, filename, contentType string, timeout time.Duration) (string, error) {
+	client, err := newIngressClient(timeout)
+	if err != nil {
+		return "", err
+	}
+
+	pr, pw := io.Pipe()
+	writer := multipart.NewWriter(pw)
+	go func() {
+		header := make(textproto.MIMEHeader)
+		header.Set("Content-Disposition", fmt.Sprintf(
+			`form-data; name="file"; filename="%s"`, filename))
+		header.Set("Content-Type", contentType)
+		part, err := writer.CreatePart(header)
+		if err == nil {
+			_, err = io.Copy(part, r)
+		}
+		if closeErr := writer.Close(); err == nil {
+			err = closeErr
+		}
+		pw.CloseWithError(err)
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, throttle(pr))
+	if err != nil {
+		return "", fmt.Errorf("could not create upload request: %w", err)
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	setUploadHeaders(req)
+
+	slog.Debug("streaming archive", "filename", filename, "url", target)
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", uploadError(ctx, client, err)
+	}
+	defer resp.Body.Close()
+
+	slog.Debug("negotiated upload protocol", "proto", resp.Proto)
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		requestID := parseRequestID(data)
+		slog.Debug("upload accepted", "request_id", requestID)
+		return requestID, nil
+	case resp.StatusCode == http.StatusMovedPermanently,
+		resp.StatusCode == http.StatusFound,
+		resp.StatusCode == http.StatusTemporaryRedirect,
+		resp.StatusCode == http.StatusPermanentRedirect:
+		return "", fmt.Errorf(
+			"%w: ingress redirected to presigned storage, which a streamed upload cannot follow; retry without streaming",
+			ErrUpload)
+	default:
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return "", fmt.Errorf("%w: %s: %s", ErrUpload, resp.Status, bytes.TrimSpace(data))
+	}
+}
+
+// uploadTarget resolves where a collector's archive goes: its own
+// upload.url override when one is set, the shared Ingress endpoint
+// otherwise.
+func uploadTarget(c Collector) string {
+	if c.Upload.URL != "" {
+		return c.Upload.URL
+	}
+	return IngressURL()
+}
+
+// Preflight verifies the Ingress endpoint answers at all, so a run
+// can fail fast instead of collecting data it could never upload.
+// Any HTTP response counts — even a rejection proves the endpoint is
+// reachable through the configured transport; only a transport-level
+// failure is an error.
+func Preflight(ctx context.Context) error {
+	client, err := newIngressClient(10 * time.Second)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, IngressURL(), nil)
+	if err != nil {
+		return fmt.Errorf("could not create preflight request: %w", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: ingress is unreachable: %w", ErrUpload, err)
+	}
+	resp.Body.Close()
+	slog.Debug("preflight passed", "url", IngressURL(), "status", resp.Status)
+	return nil
+}
+
+// UploadRateLimit caps upload bandwidth in bytes per second so a
+// large archive does not saturate a shared link; zero means
+// unlimited. It is set by the --rate-limit flag.
+var UploadRateLimit int64
+
+// throttle wraps r in a reader respecting UploadRateLimit. With no
+// limit configured, r is returned unchanged.
+func throttle(r io.Reader) io.Reader {
+	if UploadRateLimit <= 0 {
+		return r
+	}
+	return &throttledReader{r: r, rate: UploadRateLimit, start: time.Now()}
+}
+
+// throttledReader delivers bytes at a bounded average rate by
+// sleeping whenever the reads run ahead of it.
+type throttledReader struct {
+	r     io.Reader
+	rate  int64
+	start time.Time
+	read  int64
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	n, err := t.r.Read(p)
+	t.read += int64(n)
+	due := time.Duration(float64(t.read) / float64(t.rate) * float64(time.Second))
+	if ahead := due - time.Since(t.start); ahead > 0 {
+		time.Sleep(ahead)
+	}
+	return n, err
+}
+
+// uploadError wraps a transport-level upload failure, telling a
+// stalled upload apart from an exceeded run deadline.
+func uploadError(ctx context.Context, client *http.Client, err error) error {
+	if ctx.Err() != nil {
+		return fmt.Errorf("%w: run deadline exceeded during upload: %w", ErrUpload, ctx.Err())
+	}
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) && urlErr.Timeout() && client.Timeout > 0 {
+		return fmt.Errorf("%w: upload timed out after %s", ErrUpload, client.Timeout)
+	}
+	return fmt.Errorf("%w: %w", ErrUpload, err)
+}
+
+// uploadPresigned PUTs the raw archive to a presigned location that
+// Ingress redirected the initial POST to.
+func uploadPresigned(ctx context.Context, client *http.Client, location, archive, contentType string) error {
+	f, err := os.Open(archive)
+	if err != nil {
+		return fmt.Errorf("could not open archive: %w", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("could not stat archive: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, location, throttle(f))
+	if err != nil {
+		return fmt.Errorf("could not create upload request: %w", err)
+	}
+	req.ContentLength = info.Size()
+	req.Header.Set("Content-Type", contentType)
+
+	slog.Debug("uploading archive to presigned location", "url", location)
+	resp, err := client.Do(req)
+	if err != nil {
+		return uploadError(ctx, client, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("%w: %s: %s", ErrUpload, resp.Status, bytes.TrimSpace(data))
+	}
+	return nil
+}
+
+// parseRequestID extracts the request ID from an Ingress response
+// body. It returns an empty string when the body has none.
+func parseRequestID(data []byte) string {
+	var response struct {
+		RequestID string `json:"request_id"`
+	}
+	if err := json.Unmarshal(data, &response); err != nil {
+		return ""
+	}
+	return response.RequestID
+}
+
+// authMode enumerates the ways an upload can authenticate against
+// Ingress. Exactly one mode is active at a time: configuring basic
+// credentials or a token turns client-certificate authentication
+// off.
+type authMode int
+
+const (
+	// authCert authenticates with the consumer client certificate,
+	// the default.
+	authCert authMode = iota
+	// authBasic authenticates with HTTP basic credentials.
+	authBasic
+	// authToken authenticates with a bearer token.
+	authToken
+)
+
+// basicAuth returns the configured basic-auth credentials: the
+// INGRESS_USERNAME and INGRESS_PASSWORD environment variables, or
+// the configuration file values.
+func basicAuth() (username, password string) {
+	username, password = currentConfig.Username, currentConfig.Password
+	if user := os.Getenv("INGRESS_USERNAME"); user != "" {
+		username = user
+	}
+	if pass := os.Getenv("INGRESS_PASSWORD"); pass != "" {
+		password = pass
+	}
+	return username, password
+}
+
+// bearerToken returns the configured bearer token: the INGRESS_TOKEN
+// environment variable, or the configuration file value.
+func bearerToken() string {
+	if token := os.Getenv("INGRESS_TOKEN"); token != "" {
+		return token
+	}
+	return currentConfig.Token
+}
+
+// uploadAuth resolves the active authentication mode, rejecting
+// ambiguous configurations that ask for more than one.
+func uploadAuth() (authMode, error) {
+	username, _ := basicAuth()
+	token := bearerToken()
+	if username != "" && token != "" {
+		return authCert, fmt.Errorf(
+			"%w: both basic-auth credentials and a bearer token are configured; choose one",
+			ErrConfig)
+	}
+	if username != "" {
+		return authBasic, nil
+	}
+	if token != "" {
+		return authToken, nil
+	}
+	return authCert, nil
+}
+
+// ConsumerUUID returns the system's subscription-manager consumer
+// UUID, read from the client certificate's subject CN, which is how
+// uploads are associated with a host in Inventory. It returns an
+// empty string when no certificate is present or it does not parse.
+func ConsumerUUID() string {
+	certFile, _ := CertPaths()
+	data, err := os.ReadFile(certFile)
+	if err != nil {
+		return ""
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return ""
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return ""
+	}
+	return cert.Subject.CommonName
+}
+
+// setUploadHeaders adds the metadata headers shared by all upload
+// requests, so server-side debugging can associate an upload with
+// the sending host even before the payload is processed.
+func setUploadHeaders(req *http.Request) {
+	if uuid := ConsumerUUID(); uuid != "" {
+		req.Header.Set("X-Rh-Consumer-Uuid", uuid)
+	}
+	// The mode was already validated when the transport was built.
+	switch mode, _ := uploadAuth(); mode {
+	case authBasic:
+		username, password := basicAuth()
+		req.SetBasicAuth(username, password)
+	case authToken:
+		req.Header.Set("Authorization", "Bearer "+bearerToken())
+	}
+}
+
+// CertPaths returns the client certificate and key Upload
+// authenticates with: the configured paths, or the system's consumer
+// certificate.
+func CertPaths() (certFile, keyFile string) {
+	certFile, keyFile = consumerCertPath, consumerKeyPath
+	if currentConfig.CertFile != "" {
+		certFile = currentConfig.CertFile
+	}
+	if currentConfig.KeyFile != "" {
+		keyFile = currentConfig.KeyFile
+	}
+	return certFile, keyFile
+}
+
+// ingressTransport caches the transport shared by all uploads so
+// batch runs reuse connections instead of handshaking per archive.
+// It is rebuilt when the configuration is reloaded.
+var ingressTransport = struct {
+	sync.Mutex
+	transport *http.Transport
+}{}
+
+// resetIngressTransport drops the cached transport so the next upload
+// rebuilds it from the current configuration.
+func resetIngressTransport() {
+	ingressTransport.Lock()
+	defer ingressTransport.Unlock()
+	if ingressTransport.transport != nil {
+		ingressTransport.transport.CloseIdleConnections()
+		ingressTransport.transport = nil
+	}
+}
+
+// tlsMinVersion maps the configured minimum TLS version to its
+// protocol constant. Uploads never go below TLS 1.2.
+func tlsMinVersion() (uint16, error) {
+	switch currentConfig.TLSMinVersion {
+	case "", "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	}
+	return 0, fmt.Errorf("%w: invalid tls-min-version %q (valid: 1.2, 1.3)",
+		ErrConfig, currentConfig.TLSMinVersion)
+}
+
+// newIngressTransport builds the shared upload transport: client
+// certificate, proxy, a bounded keep-alive connection pool, HTTP/2
+// when Ingress offers it (falling back to HTTP/1.1), and a TLS 1.2
+// floor.
+func newIngressTransport() (*http.Transport, error) {
+	certFile, keyFile := CertPaths()
+
+	minVersion, err := tlsMinVersion()
+	if err != nil {
+		return nil, err
+	}
+	mode, err := uploadAuth()
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig := &tls.Config{MinVersion: minVersion}
+	if mode != authCert {
+		slog.Debug("uploading with configured credentials instead of the consumer certificate")
+	} else if _, err := os.Stat(certFile); err == nil {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not load consumer certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	} else {
+		slog.Debug("no consumer certificate, uploading without client authentication")
+	}
+	if currentConfig.CAFile != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		pem, err := os.ReadFile(currentConfig.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("%w: could not read CA bundle: %w", ErrConfig, err)
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%w: no certificates found in %s",
+				ErrConfig, currentConfig.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	proxy := http.ProxyFromEnvironment
+	if currentConfig.Proxy != "" {
+		proxyURL, err := url.Parse(currentConfig.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid proxy URL: %w", ErrConfig, err)
+		}
+		proxy = http.ProxyURL(proxyURL)
+	}
+
+	transport := &http.Transport{
+		TLSClientConfig: tlsConfig,
+		Proxy:           proxy,
+		// A custom TLS config disables the automatic HTTP/2 upgrade;
+		// force the attempt so large uploads can multiplex, with ALPN
+		// falling back to HTTP/1.1 against older endpoints.
+		ForceAttemptHTTP2:   true,
+		MaxIdleConns:        10,
+		MaxIdleConnsPerHost: 4,
+		IdleConnTimeout:     90 * time.Second,
+		TLSHandshakeTimeout: 10 * time.Second,
+	}
+	if currentConfig.MaxIdleConns > 0 {
+		transport.MaxIdleConns = currentConfig.MaxIdleConns
+	}
+	if value := currentConfig.IdleConnTimeout; value != "" {
+		span, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid idle-conn-timeout %q: %w",
+				ErrConfig, value, err)
+		}
+		transport.IdleConnTimeout = span
+	}
+	return transport, nil
+}
+
+// newIngressClient builds an HTTP client around the shared transport.
+// A non-zero timeout bounds each request.
+func newIngressClient(timeout time.Duration) (*http.Client, error) {
+	ingressTransport.Lock()
+	defer ingressTransport.Unlock()
+	if ingressTransport.transport == nil {
+		transport, err := newIngressTransport()
+		if err != nil {
+			return nil, err
+		}
+		ingressTransport.transport = transport
+	}
+
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: ingressTransport.transport,
+		// Redirects carry a presigned location the payload has to be
+		// PUT to; Upload handles them itself.
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}, nil
+}
@@ -0,0 +1,181 @@
+package insights
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeArchive writes a small file standing in for an archive and
+// returns its path.
+func writeArchive(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "example.tar.gz")
+	if err := os.WriteFile(path, []byte("archive-bytes"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestUpload(t *testing.T) {
+	var contentType, idempotencyKey string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		idempotencyKey = r.Header.Get(idempotencyHeader)
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Errorf("could not parse multipart body: %v", err)
+		}
+		f, header, err := r.FormFile("file")
+		if err != nil {
+			t.Fatalf("missing file part: %v", err)
+		}
+		defer f.Close()
+		contentType = header.Header.Get("Content-Type")
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(`{"request_id": "abc123"}`))
+	}))
+	defer server.Close()
+	t.Setenv("INGRESS_URL", server.URL)
+
+	requestID, err := Upload(context.Background(), writeArchive(t), "application/vnd.redhat.test+tgz", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if requestID != "abc123" {
+		t.Errorf("unexpected request ID: %q", requestID)
+	}
+	if contentType != "application/vnd.redhat.test+tgz" {
+		t.Errorf("unexpected part content type: %q", contentType)
+	}
+	digest := sha256.Sum256([]byte("archive-bytes"))
+	if idempotencyKey != hex.EncodeToString(digest[:]) {
+		t.Errorf("idempotency key does not match the archive digest: %q", idempotencyKey)
+	}
+}
+
+func TestUploadStream(t *testing.T) {
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Errorf("could not parse multipart body: %v", err)
+		}
+		f, header, err := r.FormFile("file")
+		if err != nil {
+			t.Fatalf("missing file part: %v", err)
+		}
+		defer f.Close()
+		if header.Filename != "streamed.tar.gz" {
+			t.Errorf("unexpected filename: %q", header.Filename)
+		}
+		body, _ = io.ReadAll(f)
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(`{"request_id": "xyz789"}`))
+	}))
+	defer server.Close()
+	t.Setenv("INGRESS_URL", server.URL)
+
+	requestID, err := UploadStream(context.Background(), IngressURL(),
+		strings.NewReader("streamed-bytes"), "streamed.tar.gz", "application/vnd.redhat.test+tgz", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if requestID != "xyz789" {
+		t.Errorf("unexpected request ID: %q", requestID)
+	}
+	if string(body) != "streamed-bytes" {
+		t.Errorf("streamed upload did not carry the archive: %q", body)
+	}
+}
+
+func TestUploadTarget(t *testing.T) {
+	c := Collector{}
+	if uploadTarget(c) != IngressURL() {
+		t.Error("collector without an override must target the shared endpoint")
+	}
+	c.Upload.URL = "https://edge.example.com/upload"
+	if uploadTarget(c) != "https://edge.example.com/upload" {
+		t.Error("upload.url override was not used")
+	}
+}
+
+func TestUploadPresigned(t *testing.T) {
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Location", "http://"+r.Host+"/presigned")
+			w.WriteHeader(http.StatusTemporaryRedirect)
+		case "/presigned":
+			if r.Method != http.MethodPut {
+				t.Errorf("expected PUT, got %s", r.Method)
+			}
+			body, _ = io.ReadAll(r.Body)
+			w.WriteHeader(http.StatusOK)
+		default:
+			t.Errorf("unexpected request to %s", r.URL.Path)
+		}
+	}))
+	defer server.Close()
+	t.Setenv("INGRESS_URL", server.URL)
+
+	if _, err := Upload(context.Background(), writeArchive(t), "application/vnd.redhat.test+tgz", 0); err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "archive-bytes" {
+		t.Errorf("presigned upload did not carry the raw archive: %q", body)
+	}
+}
+
+func TestUploadAuthModes(t *testing.T) {
+	var authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+	t.Setenv("INGRESS_URL", server.URL)
+
+	t.Setenv("INGRESS_TOKEN", "secret-token")
+	if _, err := Upload(context.Background(), writeArchive(t), "application/vnd.redhat.test+tgz", 0); err != nil {
+		t.Fatal(err)
+	}
+	if authorization != "Bearer secret-token" {
+		t.Errorf("unexpected Authorization header: %q", authorization)
+	}
+
+	t.Setenv("INGRESS_TOKEN", "")
+	t.Setenv("INGRESS_USERNAME", "user")
+	t.Setenv("INGRESS_PASSWORD", "pass")
+	if _, err := Upload(context.Background(), writeArchive(t), "application/vnd.redhat.test+tgz", 0); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(authorization, "Basic ") {
+		t.Errorf("expected basic auth, got %q", authorization)
+	}
+
+	// Asking for both modes at once is ambiguous.
+	t.Setenv("INGRESS_TOKEN", "secret-token")
+	resetIngressTransport()
+	if _, err := Upload(context.Background(), writeArchive(t), "application/vnd.redhat.test+tgz", 0); !errors.Is(err, ErrConfig) {
+		t.Errorf("expected ErrConfig for conflicting auth modes, got %v", err)
+	}
+}
+
+func TestUploadRejected(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "too large", http.StatusRequestEntityTooLarge)
+	}))
+	defer server.Close()
+	t.Setenv("INGRESS_URL", server.URL)
+
+	if _, err := Upload(context.Background(), writeArchive(t), "application/vnd.redhat.test+tgz", 0); err == nil {
+		t.Fatal("expected an error for a rejected upload")
+	}
+}